@@ -0,0 +1,133 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// animation is an asciimation playing for a client in the background.
+type animation struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	// done is closed when the animation and the text after it are written
+	done      chan struct{}
+	cancelled int32
+}
+
+// Play writes the frames of the asciimation to the client, every frame
+// overwrites the previous one. It returns false if stop was closed or the
+// session ended before the last frame.
+func (a *Asciimation) Play(c *Client, stop <-chan struct{}) bool {
+
+	lineCount := 0
+	frameCounter := 0
+	for _, f := range a.Frames {
+		frameCounter++
+		if lineCount == 0 {
+			lineCount = len(f.Lines)
+		}
+
+		i := 0
+		for _, l := range f.Lines {
+			i++
+			if frameCounter > 1 && i == 1 {
+				c.WriteToUser(fmt.Sprintf("\033[%dF\033[K%s\n\r", lineCount, l))
+			} else {
+				c.WriteToUser(fmt.Sprintf("\033[K%s\n\r", l))
+			}
+			if i == lineCount {
+				break
+			}
+		}
+		if frameCounter < len(a.Frames) {
+			timer := time.NewTimer(time.Duration(f.Duration) * time.Millisecond)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				return false
+			case <-c.done:
+				timer.Stop()
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// playAnimation plays a in the background and writes then after it. Input
+// of the user skips the rest of the animation, then is still written.
+// Leaving the room cancels it, then is dropped.
+func (c *Client) playAnimation(a Asciimation, then func()) {
+	c.stopAnimation(true)
+
+	anim := &animation{stop: make(chan struct{}), done: make(chan struct{})}
+	c.animLock.Lock()
+	c.animation = anim
+	c.animLock.Unlock()
+
+	go func() {
+		a.Play(c, anim.stop)
+		if atomic.LoadInt32(&anim.cancelled) == 0 {
+			then()
+		}
+		c.animLock.Lock()
+		if c.animation == anim {
+			c.animation = nil
+		}
+		c.animLock.Unlock()
+		close(anim.done)
+	}()
+}
+
+// stopAnimation stops the running animation and waits until it stopped
+// writing, cancel drops the text after the animation.
+func (c *Client) stopAnimation(cancel bool) {
+	c.animLock.Lock()
+	anim := c.animation
+	c.animLock.Unlock()
+	if anim == nil {
+		return
+	}
+	anim.stopOnce.Do(func() {
+		if cancel {
+			atomic.StoreInt32(&anim.cancelled, 1)
+		}
+		close(anim.stop)
+	})
+	select {
+	case <-anim.done:
+	case <-c.done:
+	}
+}
+
+// waitAnimation blocks until the running animation is over, so other output
+// does not end up inside of its frames.
+func (c *Client) waitAnimation() {
+	c.animLock.Lock()
+	anim := c.animation
+	c.animLock.Unlock()
+	if anim == nil {
+		return
+	}
+	select {
+	case <-anim.done:
+	case <-c.done:
+	}
+}
+
+// skipReader reads the input of the client and skips the running animation
+// as soon as the user types something.
+type skipReader struct {
+	c *Client
+}
+
+func (r skipReader) Read(p []byte) (int, error) {
+	n, err := r.c.Conn.Read(p)
+	if n > 0 {
+		r.c.stopAnimation(false)
+	}
+	return n, err
+}
@@ -0,0 +1,116 @@
+package game
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeTestAnimation has two frames, the first one is shown for an hour.
+func makeTestAnimation() Asciimation {
+	return Asciimation{Frames: []Frame{
+		{Id: 1, Duration: 3600000, Lines: []string{"first frame"}},
+		{Id: 2, Lines: []string{"second frame"}},
+	}}
+}
+
+func makeAnimatedTestServer(t *testing.T) *Server {
+	s := makeTestServer(t)
+	b, _ := s.GetRoom("B")
+	b.Intro = "RoomBIntro"
+	b.Asciimation = makeTestAnimation()
+	s.addLevel(b)
+	return s
+}
+
+func TestAnimationSkippedByInput(t *testing.T) {
+	s := makeAnimatedTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+
+	start := time.Now()
+	output := runTestSessionOutput(s, &Player{Nickname: "watcher", Position: "A"}, "east\ninventory\n")
+	if time.Since(start) > time.Minute {
+		t.Error("Input should not wait for the animation")
+	}
+	if !strings.Contains(output, "first frame") {
+		t.Errorf("Animation should start, got %q", output)
+	}
+	if strings.Contains(output, "second frame") {
+		t.Errorf("Input should skip the animation, got %q", output)
+	}
+	intro := strings.Index(output, "RoomBIntro")
+	inventory := strings.Index(output, "You carry nothing.")
+	if intro < 0 || inventory < intro {
+		t.Errorf("The room should be described after a skipped animation and before the next command, got %q", output)
+	}
+}
+
+func TestAnimationPreference(t *testing.T) {
+	s := makeAnimatedTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+
+	p := &Player{Nickname: "blind", Position: "A"}
+	output := runTestSessionOutput(s, p, "set animations off\neast\n")
+	if !strings.Contains(output, "animations is now off.") {
+		t.Errorf("Preference should be set, got %q", output)
+	}
+	if strings.Contains(output, "first frame") || !strings.Contains(output, "RoomBIntro") {
+		t.Errorf("Animations should not play when they are off, got %q", output)
+	}
+	if p.Preference("animations") != "off" {
+		t.Error("Preference should be stored in the player")
+	}
+}
+
+func TestAnimationCancel(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go io.Copy(ioutil.Discard, peer)
+	c := NewClient(conn, &Player{Nickname: "mover"})
+	defer c.Close()
+
+	described := make(chan bool, 1)
+	c.playAnimation(makeTestAnimation(), func() { described <- true })
+	c.stopAnimation(true)
+	select {
+	case <-described:
+		t.Error("Cancelled animations should not describe the room")
+	default:
+	}
+
+	c.playAnimation(makeTestAnimation(), func() { described <- true })
+	c.stopAnimation(false)
+	select {
+	case <-described:
+	default:
+		t.Error("Skipped animations should describe the room")
+	}
+
+	c.playAnimation(makeTestAnimation(), func() { described <- true })
+	c.Close()
+	c.waitAnimation()
+}
+
+func TestSetCommand(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+
+	output := runTestSessionOutput(s, &Player{Nickname: "setter", Position: "A"},
+		"set\nset animatons off\nset animations\nset animations maybe\nset animations OFF\nset animations\n")
+	for _, expected := range []string{
+		"animations   on    play the animations of rooms (on or off)",
+		"Unknown preference animatons. Did you mean animations?",
+		"animations is on.",
+		"animations can be on or off.",
+		"animations is now off.",
+		"animations is off.",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Output should contain %q, got %q", expected, output)
+		}
+	}
+}
@@ -7,40 +7,130 @@ import (
 	"log"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Client is the session of a logged in player. It points to the one Player
+// instance the server keeps for the character, so every change is visible
+// to the server and other sessions right away.
 type Client struct {
 	Conn     net.Conn
 	Nickname string
-	Player   Player
+	Player   *Player
 	Ch       chan string
+	Width    int
+
+	closeOnce sync.Once
+	done      chan struct{}
+	quit      int32
+	// reader reads the input of the user, commands use it for prompts
+	reader *bufio.Reader
+	// animation is the asciimation playing in the background, if any
+	animLock  sync.Mutex
+	animation *animation
 }
 
-func NewClient(c net.Conn, player Player) Client {
-	return Client{
+// outboundQueueSize is how many messages of other players can wait for the
+// writer of a client.
+const outboundQueueSize = 64
+
+func NewClient(c net.Conn, player *Player) *Client {
+	return &Client{
 		Conn:     c,
 		Nickname: player.Nickname,
 		Player:   player,
-		Ch:       make(chan string),
+		Ch:       make(chan string, outboundQueueSize),
+		done:     make(chan struct{}),
 	}
 }
 
-func (c Client) WriteToUser(msg string) {
+// Close ends the session, it closes the connection and stops
+// WriteLinesFrom. It is safe to call Close more than once.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+}
+
+// HasQuit reports whether the user left with the quit command instead of
+// losing the connection.
+func (c *Client) HasQuit() bool {
+	return atomic.LoadInt32(&c.quit) == 1
+}
+
+// Done is closed when the session ended.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) WriteToUser(msg string) {
 	io.WriteString(c.Conn, msg)
 }
 
-func (c Client) WriteLineToUser(msg string) {
-	io.WriteString(c.Conn, msg+"\n\r")
+// LineWidth is the terminal width reported by the telnet client or the
+// configured default width when the client did not tell us.
+func (c *Client) LineWidth() int {
+	if tc, ok := c.Conn.(*TelnetConn); ok {
+		if width, _ := tc.WindowSize(); width > 0 {
+			return width
+		}
+	}
+	return c.Width
+}
+
+func (c *Client) WriteLineToUser(msg string) {
+	for _, line := range WrapText(msg, c.LineWidth()) {
+		io.WriteString(c.Conn, line+"\n\r")
+	}
+}
+
+// WriteMessageToUser writes msg as " > msg", wrapped lines are indented
+// below the text.
+func (c *Client) WriteMessageToUser(msg string) {
+	for i, line := range WrapText(msg, c.LineWidth()-3) {
+		if i == 0 {
+			io.WriteString(c.Conn, " > "+line+"\n\r")
+		} else {
+			io.WriteString(c.Conn, "   "+line+"\n\r")
+		}
+	}
 }
 
-func (c Client) ReadLinesInto(ch chan<- string, server *Server) {
-	bufc := bufio.NewReader(c.Conn)
+// ReadLinesInto reads and executes the commands of the user until the
+// connection is closed, then it closes the session.
+func (c *Client) ReadLinesInto(server *Server) {
+	defer c.Close()
+	c.reader = bufio.NewReader(skipReader{c})
+	bufc := c.reader
 
+	warned := false
+	var pending string
 	for {
+		config := server.GetConfig()
+		c.setIdleDeadline(config, warned)
 		line, err := bufc.ReadString('\n')
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			pending += line
+			if !warned && config.idleWarning() > 0 {
+				c.WriteLineToUser(fmt.Sprintf("You are idle, you will be disconnected in %d seconds.", config.IdleWarning))
+				warned = true
+				continue
+			}
+			log.Printf("%s was idle for too long", c.Player.Nickname)
+			c.WriteLineToUser("You have been idle for too long, good bye.")
+			atomic.StoreInt32(&c.quit, 1)
+			server.SavePlayer(c.Player)
+			break
+		}
 		if err != nil {
 			break
 		}
+		line = pending + line
+		pending = ""
+		warned = false
 
 		userLine := strings.TrimSpace(line)
 
@@ -60,99 +150,298 @@ func (c Client) ReadLinesInto(ch chan<- string, server *Server) {
 		}
 
 		log.Printf("Command by %s: %s  -  %s", c.Player.Nickname, command, commandText)
+		server.Hub.Touch(c)
+		// lines typed ahead were read before the animation started
+		c.stopAnimation(false)
 
-		switch command {
-		case "look":
-			fallthrough
-		case "watch":
-			place, ok := server.GetRoom(c.Player.Position)
-			if ok {
-				for _, direction := range place.Directions {
-					place, ok := server.GetRoom(direction.Station)
-					if ok && place.CanSeeDirection(direction, c.Player, commandText) {
-						c.WriteLineToUser(fmt.Sprintf(" • When you look \033[1;30;41m%s\033[0m you see %s", direction.Direction, place.Name))
-					}
-				}
-			}
-		case "go":
-			place, ok := server.GetRoom(c.Player.Position)
-			if ok {
-				for _, oneDirection := range place.Directions {
-					if strings.ToLower(oneDirection.Direction) == strings.ToLower(commandText) {
-						place, ok := server.GetRoom(oneDirection.Station)
-						if ok {
-							canEnter, message := place.CanGoDirection(oneDirection, c.Player)
-							if !canEnter {
-								c.WriteLineToUser(" >" + message)
-							} else {
-								place.OnEnterRoom(server, c)
-								c.Player.Position = string(place.Key)
-								log.Println(c.Player)
-								c.Player.LogAction(place.Key)
-								server.SavePlayer(c.Player)
-							}
-						} else {
-							c.WriteToUser("\n")
-						}
-					}
-				}
+		c.runCommand(server, command, commandText)
+	}
+}
+
+// runCommand runs the command, room action or move the user typed. Bare
+// directions move the player, unique prefixes of commands and room actions
+// are accepted as abbreviations.
+func (c *Client) runCommand(server *Server, command string, args string) {
+	permission := server.PermissionOf(c.Player)
+	if cmd, ok := server.Commands.Lookup(command); ok && cmd.Permission <= permission {
+		cmd.Run(c, server, args)
+		return
+	}
+	if c.doRoomAction(server, command) {
+		return
+	}
+
+	place, _ := server.GetRoom(c.Player.GetPosition())
+	if args == "" {
+		if _, ok := place.FindDirection(command); ok || IsDirectionWord(command) {
+			goCommand(c, server, command)
+			return
+		}
+	}
+
+	var names []string
+	var match *Command
+	for _, cmd := range server.Commands.Available(permission) {
+		for _, name := range cmd.Names() {
+			if strings.HasPrefix(strings.ToLower(name), strings.ToLower(command)) {
+				names = append(names, name)
+				match = cmd
+				break
 			}
-		case "say":
-			// TODO: implement channel wide communication
-			io.WriteString(c.Conn, "\033[1F\033[K") // up one line so we overwrite the say command typed with the result
-			ch <- fmt.Sprintf("%s: %s", c.Player.Gamename, commandText)
-		case "quit":
-			fallthrough
-		case "leave":
-			fallthrough
-		case "exit":
-			server.OnExit(c)
-			c.Conn.Close()
-		case "help":
-			c.WriteHelp(server)
-		default:
-			place, gotRoom := server.GetRoom(c.Player.Position)
-			if gotRoom {
-				action, gotRoomAction := place.GetRoomAction(command)
-				if gotRoomAction {
-					isAllowed, message := place.CanDoAction(action, c.Player)
-					if message != "" {
-						lines := strings.Split(message, "\n")
-						for _, line := range lines {
-							c.WriteLineToUser(fmt.Sprintf(" > %s", line))
-						}
-					}
-					if isAllowed {
-						actionName := place.GetRoomActionName(action)
-						c.Player.LogAction(actionName)
-						server.SavePlayer(c.Player)
-					}
-					continue
-				}
+		}
+	}
+	actions := place.ActionsWithPrefix(command)
+	for _, action := range actions {
+		names = appendUnique(names, action)
+	}
+
+	switch {
+	case len(names) == 1 && match != nil:
+		match.Run(c, server, args)
+	case len(names) == 1:
+		c.doRoomAction(server, actions[0])
+	case len(names) > 1:
+		c.WriteLineToUser(fmt.Sprintf("%s is ambiguous, did you mean %s?", command, strings.Join(names, ", ")))
+	default:
+		c.unknownCommand(server, place, permission, command)
+	}
+}
+
+// unknownCommand tells the user that command does not exist and suggests
+// similar commands, room actions and directions.
+func (c *Client) unknownCommand(server *Server, place Level, permission Permission, command string) {
+	var candidates []string
+	for _, cmd := range server.Commands.Available(permission) {
+		candidates = append(candidates, cmd.Names()...)
+	}
+	for _, action := range place.Actions {
+		candidates = append(candidates, action.Name)
+	}
+	for _, d := range place.Directions {
+		if place.CanSeeDirection(d, c.Player, "") {
+			candidates = append(candidates, d.Direction)
+		}
+	}
+	c.WriteLineToUser(strings.TrimSpace(fmt.Sprintf("Unknown command %s. %s", command, didYouMean(Suggest(command, candidates)))))
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// doRoomAction runs the action the current room defines for command, it
+// reports false if there is none.
+func (c *Client) doRoomAction(server *Server, command string) bool {
+	place, gotRoom := server.GetRoom(c.Player.GetPosition())
+	if !gotRoom {
+		return false
+	}
+	action, gotRoomAction := place.GetRoomAction(command)
+	if !gotRoomAction {
+		return false
+	}
+	isAllowed, message := place.CanDoAction(action, c.Player, server.Moment())
+	if message != "" {
+		lines := strings.Split(message, "\n")
+		for _, line := range lines {
+			c.WriteMessageToUser(line)
+		}
+	}
+	if isAllowed {
+		actionName := place.GetRoomActionName(action)
+		c.Player.LogAction(actionName)
+		c.applyEffects(server, action.Effects)
+		server.SavePlayer(c.Player)
+	}
+	return true
+}
+
+// setIdleDeadline limits the wait for the next command to the idle time
+// left until the warning or, once warned, until the disconnect.
+func (c *Client) setIdleDeadline(config ServerConfig, warned bool) {
+	if config.IdleTimeout <= 0 {
+		return
+	}
+	timeout := config.IdleTimeout - config.idleWarning()
+	if warned {
+		timeout = config.idleWarning()
+	}
+	c.Conn.SetReadDeadline(time.Now().Add(time.Duration(timeout) * time.Second))
+}
+
+// WriteOccupants lists the other players in room.
+func (c *Client) WriteOccupants(server *Server, room string) {
+	var names []string
+	for _, p := range server.Hub.InRoom(room) {
+		if p.Nickname != c.Player.Nickname {
+			names = append(names, p.Gamename)
+		}
+	}
+	if len(names) > 0 {
+		c.WriteMessageToUser("Also here: " + strings.Join(names, ", "))
+	}
+}
+
+// WriteItems lists the items lying in room.
+func (c *Client) WriteItems(server *Server, room string) {
+	if items := server.ItemsInRoom(room); len(items) > 0 {
+		c.WriteMessageToUser("You see: " + strings.Join(itemNames(items), ", "))
+	}
+}
+
+// WriteWho lists the players that are online.
+func (c *Client) WriteWho(server *Server) {
+	online := server.Online()
+	config := server.GetConfig()
+	c.WriteLineToUser(fmt.Sprintf("%d player(s) online:", len(online)))
+	for _, p := range online {
+		line := fmt.Sprintf(" • %-15s %-20s %-12s idle %s", p.Nickname, p.Gamename, p.PlayerType, FormatIdle(p.Idle()))
+		if p.LinkDead {
+			line += " (link dead)"
+		} else if config.IsAFK(p) {
+			line += " (AFK)"
+		}
+		if config.WhoShowsRooms {
+			if room, ok := server.GetRoom(p.Room); ok {
+				line += " at " + room.Name
 			}
-			c.WriteToUser("\033[1F\033[K")
 		}
+		c.WriteLineToUser(line)
 	}
 }
 
-func (c Client) WriteHelp(server *Server) {
+// FormatIdle shortens an idle duration to its largest unit.
+func FormatIdle(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+func (c *Client) tell(server *Server, nickname string, text string) {
+	receiver, ok := server.Hub.Tell(c, nickname, fmt.Sprintf("%s tells you: %s", c.Player.Gamename, text))
+	if !ok {
+		c.WriteLineToUser(fmt.Sprintf("%s is not online.", nickname))
+		return
+	}
+	c.WriteLineToUser(fmt.Sprintf("You tell %s: %s", receiver, text))
+}
+
+// SetEcho switches the echo of the users input on the client on or off.
+func (c *Client) SetEcho(on bool) {
+	if tc, ok := c.Conn.(*TelnetConn); ok {
+		tc.SuppressEcho(!on)
+	}
+}
+
+// PromptPassword asks for a password without echoing the input.
+func (c *Client) PromptPassword(bufc *bufio.Reader, message string) (string, error) {
+	c.WriteToUser(message)
+	c.SetEcho(false)
+	defer c.SetEcho(true)
+	line, err := bufc.ReadString('\n')
+	c.WriteToUser("\n\r")
+	return strings.TrimSpace(line), err
+}
+
+func (c *Client) changePassword(server *Server) {
+	bufc := c.reader
+	if c.Player.HasPassword() {
+		old, err := c.PromptPassword(bufc, "Current password: ")
+		if err != nil {
+			return
+		}
+		if !c.Player.CheckPassword(old) {
+			c.WriteLineToUser("Wrong password.")
+			return
+		}
+	}
+	password, ok := c.promptNewPassword()
+	if !ok {
+		return
+	}
+	if err := c.Player.SetPassword(password); err != nil {
+		c.WriteLineToUser(fmt.Sprintf("Password not changed: %s.", err))
+		return
+	}
+	server.SavePlayer(c.Player)
+	c.WriteLineToUser("Password changed.")
+}
+
+// promptNewPassword asks twice for a new password, it returns false if the
+// passwords do not match.
+func (c *Client) promptNewPassword() (string, bool) {
+	password, err := c.PromptPassword(c.reader, "New password: ")
+	if err != nil {
+		return "", false
+	}
+	repeated, err := c.PromptPassword(c.reader, "Repeat new password: ")
+	if err != nil {
+		return "", false
+	}
+	if password != repeated {
+		c.WriteLineToUser("Passwords do not match.")
+		return "", false
+	}
+	return password, true
+}
+
+// setPasswordOf lets an admin set the password of another player, accounts
+// without a password can only log in after that.
+func (c *Client) setPasswordOf(server *Server, nick string) {
+	if !server.LoadPlayer(nick) {
+		c.WriteLineToUser(fmt.Sprintf("Player %s does not exist.", nick))
+		return
+	}
+	password, ok := c.promptNewPassword()
+	if !ok {
+		return
+	}
+	if !server.SetPlayerPassword(nick, password) {
+		c.WriteLineToUser("Password not changed.")
+		return
+	}
+	log.Printf("%s set the password of %s", c.Nickname, nick)
+	c.WriteLineToUser(fmt.Sprintf("Password of %s changed.", nick))
+}
+
+// WriteHelp lists the commands the player may use.
+func (c *Client) WriteHelp(server *Server) {
 	c.WriteLineToUser("┌─>")
-	c.WriteLineToUser(fmt.Sprintf("│ %s Help", server.Config.Name))
+	c.WriteLineToUser(fmt.Sprintf("│ %s Help", server.GetName()))
 	c.WriteLineToUser("│")
 	c.WriteLineToUser("│ Commands:")
-	c.WriteLineToUser("│  * look|watch        look arround you")
-	c.WriteLineToUser("│  * go                go into a specific direction")
-	c.WriteLineToUser("│  * say               say something to the persons near you")
-	c.WriteLineToUser("│  * quit|leave|exit   leave the server")
+	for _, cmd := range server.Commands.Available(server.PermissionOf(c.Player)) {
+		c.WriteLineToUser(fmt.Sprintf("│  * %-18s %s", strings.Join(cmd.Names(), "|"), cmd.Help))
+	}
 	c.WriteLineToUser("│")
+	c.WriteLineToUser("│  * help <command> shows how to use a command")
 	c.WriteLineToUser("│  * there can always be room specific commands")
 	c.WriteLineToUser("└─>")
 }
 
-func (c Client) WriteLinesFrom(ch <-chan string) {
-	for msg := range ch {
-		_, err := io.WriteString(c.Conn, msg)
-		if err != nil {
+// WriteLinesFrom writes the messages from ch to the user until the session
+// ends.
+func (c *Client) WriteLinesFrom(ch <-chan string) {
+	for {
+		select {
+		case msg := <-ch:
+			c.waitAnimation()
+			lines := WrapText(msg, c.LineWidth())
+			_, err := io.WriteString(c.Conn, strings.Join(lines, "\n\r"))
+			if err != nil {
+				return
+			}
+		case <-c.done:
 			return
 		}
 	}
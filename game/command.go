@@ -0,0 +1,100 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Permission is the level a player needs to use a command.
+type Permission int
+
+const (
+	PermissionPlayer Permission = iota
+	PermissionAdmin
+)
+
+// Command is a command the players can type. The first word of the input
+// selects the command by its name or one of its aliases, the rest of the
+// line is passed to Run as args.
+type Command struct {
+	Name    string
+	Aliases []string
+	// Syntax describes the arguments, like "<nick> <text>"
+	Syntax     string
+	Help       string
+	Permission Permission
+	Run        func(c *Client, server *Server, args string)
+}
+
+// Names lists the name and the aliases of the command.
+func (cmd *Command) Names() []string {
+	return append([]string{cmd.Name}, cmd.Aliases...)
+}
+
+// Usage shows how to call the command, like "tell <nick> <text>".
+func (cmd *Command) Usage() string {
+	if cmd.Syntax == "" {
+		return cmd.Name
+	}
+	return cmd.Name + " " + cmd.Syntax
+}
+
+// Commands is a registry of commands, it is safe for concurrent use.
+type Commands struct {
+	lock     sync.RWMutex
+	commands []*Command
+	byName   map[string]*Command
+}
+
+func NewCommands() *Commands {
+	return &Commands{
+		byName: make(map[string]*Command),
+	}
+}
+
+// Register adds a command. Names and aliases are case insensitive and must
+// not be taken by another command.
+func (r *Commands) Register(cmd *Command) error {
+	if cmd.Name == "" || cmd.Run == nil {
+		return fmt.Errorf("command %q needs a name and a Run function", cmd.Name)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, name := range cmd.Names() {
+		if _, ok := r.byName[strings.ToLower(name)]; ok {
+			return fmt.Errorf("command %q is registered already", name)
+		}
+	}
+	for _, name := range cmd.Names() {
+		r.byName[strings.ToLower(name)] = cmd
+	}
+	r.commands = append(r.commands, cmd)
+	return nil
+}
+
+// Lookup finds a command by its name or one of its aliases.
+func (r *Commands) Lookup(name string) (*Command, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	cmd, ok := r.byName[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// Available lists the commands a player with the given permission may use,
+// sorted by name.
+func (r *Commands) Available(permission Permission) []*Command {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var available []*Command
+	for _, cmd := range r.commands {
+		if cmd.Permission <= permission {
+			available = append(available, cmd)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool {
+		return available[i].Name < available[j].Name
+	})
+	return available
+}
@@ -0,0 +1,145 @@
+package game
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCommandsRegister(t *testing.T) {
+	commands := NewCommands()
+	run := func(c *Client, server *Server, args string) {}
+
+	if err := commands.Register(&Command{Name: "look", Aliases: []string{"watch"}, Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	if err := commands.Register(&Command{Name: "Watch", Run: run}); err == nil {
+		t.Error("Should not register a name that is taken by an alias")
+	}
+	if err := commands.Register(&Command{Name: "nothing"}); err == nil {
+		t.Error("Should not register a command without Run")
+	}
+	if _, ok := commands.Lookup("nothing"); ok {
+		t.Error("Failed commands should not be registered")
+	}
+
+	for _, name := range []string{"look", "watch", "LOOK"} {
+		cmd, ok := commands.Lookup(name)
+		if !ok || cmd.Name != "look" {
+			t.Errorf("Lookup of %q should find look", name)
+		}
+	}
+}
+
+func TestCommandsAvailable(t *testing.T) {
+	commands := NewCommands()
+	run := func(c *Client, server *Server, args string) {}
+	commands.Register(&Command{Name: "who", Run: run})
+	commands.Register(&Command{Name: "reload", Permission: PermissionAdmin, Run: run})
+	commands.Register(&Command{Name: "go", Run: run})
+
+	var names []string
+	for _, cmd := range commands.Available(PermissionPlayer) {
+		names = append(names, cmd.Name)
+	}
+	if strings.Join(names, ",") != "go,who" {
+		t.Errorf("Players should see go,who, got %v", names)
+	}
+	if len(commands.Available(PermissionAdmin)) != 3 {
+		t.Error("Admins should see all commands")
+	}
+}
+
+func TestCommandsFromOtherPackages(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+
+	called := ""
+	s.Commands.Register(&Command{
+		Name:   "dance",
+		Syntax: "<style>",
+		Help:   "dance a little",
+		Run: func(c *Client, server *Server, args string) {
+			called = args
+		},
+	})
+	player := &Player{Nickname: "alice", Position: "A"}
+	output := runTestSessionOutput(s, player, "dance wildly\nhelp\nhelp dance\n")
+
+	if called != "wildly" {
+		t.Errorf("Registered commands should be run with their arguments, got %q", called)
+	}
+	if !strings.Contains(output, "dance              dance a little") {
+		t.Errorf("Help should list registered commands, got %q", output)
+	}
+	if !strings.Contains(output, "dance <style> - dance a little") {
+		t.Errorf("Help should show the syntax of a command, got %q", output)
+	}
+}
+
+func TestClientShortcutsAndAbbreviations(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	a, _ := s.GetRoom("A")
+	a.Actions = append(a.Actions, Action{Name: "solder", Answer: "You solder a blinkenlight."})
+	s.addLevel(a)
+
+	player := &Player{Nickname: "alice", Position: "A"}
+	runTestSessionOutput(s, player, "e\n")
+	if player.GetPosition() != "B" {
+		t.Errorf("e should go East, got %q", player.GetPosition())
+	}
+
+	output := runTestSessionOutput(s, player, "go w\nsol\nwh\nn\n")
+	if player.GetPosition() != "A" {
+		t.Errorf("go w should go West, got %q", player.GetPosition())
+	}
+	if !player.HasAction("A:solder") || !strings.Contains(output, "You solder a blinkenlight.") {
+		t.Errorf("sol should run the solder action, got %q", output)
+	}
+	if !strings.Contains(output, "wh is ambiguous, did you mean whisper, who?") {
+		t.Errorf("Ambiguous abbreviations should be reported, got %q", output)
+	}
+	if !strings.Contains(output, "You can not go n from here.") {
+		t.Errorf("Unknown directions should be reported, got %q", output)
+	}
+}
+
+func TestClientUnknownCommand(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+
+	player := &Player{Nickname: "alice", Position: "A"}
+	output := runTestSessionOutput(s, player, "lok\ngo Esat\nxyzzy\n")
+
+	if !strings.Contains(output, "Unknown command lok. Did you mean look?") {
+		t.Errorf("Unknown commands should get suggestions, got %q", output)
+	}
+	if !strings.Contains(output, "You can not go Esat from here. Did you mean East?") {
+		t.Errorf("Unknown directions should get suggestions, got %q", output)
+	}
+	if !strings.Contains(output, "Unknown command xyzzy.\n") {
+		t.Errorf("Unknown commands should be reported, got %q", output)
+	}
+}
+
+func TestClientAdminCommands(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	s.Config.Admins = []string{"root"}
+
+	player := &Player{Nickname: "alice", Position: "A"}
+	output := runTestSessionOutput(s, player, "help\nreload\n")
+	if strings.Contains(output, "reload") && !strings.Contains(output, "Unknown command reload.") {
+		t.Errorf("Players should not see admin commands, got %q", output)
+	}
+
+	admin := &Player{Nickname: "root", Position: "A"}
+	output = runTestSessionOutput(s, admin, "help\nreload\n")
+	if !strings.Contains(output, "read the config and the levels again") {
+		t.Errorf("Admins should see admin commands, got %q", output)
+	}
+	if !strings.Contains(output, "Nothing reloaded") {
+		t.Errorf("Admins should be able to reload, got %q", output)
+	}
+}
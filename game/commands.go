@@ -0,0 +1,397 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// builtinCommands are registered with every new server.
+func builtinCommands() []*Command {
+	return []*Command{
+		{
+			Name:    "look",
+			Aliases: []string{"watch"},
+			Syntax:  "[direction]",
+			Help:    "look arround you",
+			Run:     lookCommand,
+		},
+		{
+			Name:   "go",
+			Syntax: "<direction>",
+			Help:   "go into a specific direction",
+			Run:    goCommand,
+		},
+		{
+			Name:   "say",
+			Syntax: "<text>",
+			Help:   "say something to the persons near you",
+			Run:    sayCommand,
+		},
+		{
+			Name:   "shout",
+			Syntax: "<text>",
+			Help:   "say something to everybody on the server",
+			Run:    shoutCommand,
+		},
+		{
+			Name:    "emote",
+			Aliases: []string{"me"},
+			Syntax:  "<text>",
+			Help:    "show the persons near you what you are doing",
+			Run:     emoteCommand,
+		},
+		{
+			Name:    "tell",
+			Aliases: []string{"whisper"},
+			Syntax:  "<nick> <text>",
+			Help:    "send a private message",
+			Run:     tellCommand,
+		},
+		{
+			Name:   "reply",
+			Syntax: "<text>",
+			Help:   "answer the last private message",
+			Run:    replyCommand,
+		},
+		{
+			Name:    "get",
+			Aliases: []string{"take"},
+			Syntax:  "<item>",
+			Help:    "pick up an item",
+			Run:     getCommand,
+		},
+		{
+			Name:   "drop",
+			Syntax: "<item>",
+			Help:   "drop an item you carry",
+			Run:    dropCommand,
+		},
+		{
+			Name:    "inventory",
+			Aliases: []string{"inv", "i"},
+			Help:    "list the items you carry",
+			Run:     inventoryCommand,
+		},
+		{
+			Name:    "examine",
+			Aliases: []string{"x"},
+			Syntax:  "<item>",
+			Help:    "take a closer look at an item",
+			Run:     examineCommand,
+		},
+		{
+			Name: "who",
+			Help: "list the players that are online",
+			Run: func(c *Client, server *Server, args string) {
+				c.WriteWho(server)
+			},
+		},
+		{
+			Name: "time",
+			Help: "show the time of the game and of the world",
+			Run:  timeCommand,
+		},
+		{
+			Name:   "set",
+			Syntax: "[preference [value]]",
+			Help:   "show or change your preferences",
+			Run:    setCommand,
+		},
+		{
+			Name: "password",
+			Help: "change your password",
+			Run: func(c *Client, server *Server, args string) {
+				c.changePassword(server)
+			},
+		},
+		{
+			Name:   "help",
+			Syntax: "[command]",
+			Help:   "show this help or the help of one command",
+			Run:    helpCommand,
+		},
+		{
+			Name:       "setpassword",
+			Syntax:     "<nick>",
+			Help:       "set the password of a player",
+			Permission: PermissionAdmin,
+			Run:        setPasswordCommand,
+		},
+		{
+			Name:       "reload",
+			Help:       "read the config and the levels again",
+			Permission: PermissionAdmin,
+			Run:        reloadCommand,
+		},
+		{
+			Name:    "quit",
+			Aliases: []string{"leave", "exit"},
+			Help:    "leave the server",
+			Run:     quitCommand,
+		},
+	}
+}
+
+func lookCommand(c *Client, server *Server, args string) {
+	place, ok := server.GetRoom(c.Player.GetPosition())
+	if !ok {
+		return
+	}
+	for _, direction := range place.Directions {
+		place, ok := server.GetRoom(direction.Station)
+		if ok && place.CanSeeDirection(direction, c.Player, args) {
+			c.WriteLineToUser(fmt.Sprintf(" • When you look \033[1;30;41m%s\033[0m you see %s", direction.Direction, place.Name))
+		}
+	}
+	if args == "" {
+		c.WriteItems(server, c.Player.GetPosition())
+		c.WriteOccupants(server, c.Player.GetPosition())
+	}
+}
+
+func goCommand(c *Client, server *Server, args string) {
+	place, ok := server.GetRoom(c.Player.GetPosition())
+	if !ok {
+		return
+	}
+	if args == "" {
+		c.WriteLineToUser("Go where? (go <direction>)")
+		return
+	}
+	oneDirection, ok := place.FindDirection(args)
+	if !ok {
+		var directions []string
+		for _, d := range place.Directions {
+			if place.CanSeeDirection(d, c.Player, "") {
+				directions = append(directions, d.Direction)
+			}
+		}
+		c.WriteLineToUser(strings.TrimSpace(fmt.Sprintf("You can not go %s from here. %s", args, didYouMean(Suggest(args, directions)))))
+		return
+	}
+	target, ok := server.GetRoom(oneDirection.Station)
+	if !ok {
+		c.WriteToUser("\n")
+		return
+	}
+	canEnter, message := target.CanGoDirection(oneDirection, c.Player, server.Moment())
+	if !canEnter {
+		c.WriteMessageToUser(message)
+		return
+	}
+	arrive := fmt.Sprintf("%s arrives", c.Player.Gamename)
+	if back, ok := target.DirectionTo(place.Key); ok {
+		arrive = fmt.Sprintf("%s arrives from the %s", c.Player.Gamename, back.Direction)
+	}
+	c.enterRoom(server, target, fmt.Sprintf("%s leaves %s", c.Player.Gamename, oneDirection.Direction), arrive)
+}
+
+// enterRoom moves the player into target, the players in the old and the
+// new room are told with leave and arrive.
+func (c *Client) enterRoom(server *Server, target Level, leave string, arrive string) {
+	from := c.Player.GetPosition()
+	server.Hub.RoomExcept(from, c.Player.Nickname, leave)
+	target.OnEnterRoom(server, c)
+	c.Player.SetPosition(target.Key)
+	server.Hub.RoomExcept(target.Key, c.Player.Nickname, arrive)
+	log.Printf("%s moved to %s", c.Player.Nickname, target.Key)
+	c.Player.LogAction(target.Key)
+	server.SavePlayer(c.Player)
+}
+
+func sayCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteLineToUser("Say what?")
+		return
+	}
+	c.WriteToUser("\033[1F\033[K") // up one line so we overwrite the say command typed with the result
+	server.Hub.Room(c.Player.GetPosition(), fmt.Sprintf("%s: %s", c.Player.Gamename, args))
+}
+
+func shoutCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteLineToUser("Shout what?")
+		return
+	}
+	c.WriteToUser("\033[1F\033[K")
+	server.Hub.Broadcast(fmt.Sprintf("%s shouts: %s", c.Player.Gamename, args))
+}
+
+func emoteCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteLineToUser("Emote what?")
+		return
+	}
+	c.WriteToUser("\033[1F\033[K")
+	server.Hub.Room(c.Player.GetPosition(), fmt.Sprintf("* %s %s", c.Player.Gamename, args))
+}
+
+func tellCommand(c *Client, server *Server, args string) {
+	tellParts := strings.SplitN(args, " ", 2)
+	if len(tellParts) < 2 || strings.TrimSpace(tellParts[1]) == "" {
+		c.WriteLineToUser("Tell whom what? (tell <nick> <text>)")
+		return
+	}
+	c.tell(server, tellParts[0], strings.TrimSpace(tellParts[1]))
+}
+
+func replyCommand(c *Client, server *Server, args string) {
+	lastTell := server.Hub.LastTell(c)
+	if lastTell == "" {
+		c.WriteLineToUser("Nobody told you anything yet.")
+		return
+	}
+	if args == "" {
+		c.WriteLineToUser("Reply what?")
+		return
+	}
+	c.tell(server, lastTell, args)
+}
+
+func helpCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteHelp(server)
+		return
+	}
+	cmd, ok := server.Commands.Lookup(args)
+	if !ok || cmd.Permission > server.PermissionOf(c.Player) {
+		c.WriteLineToUser(fmt.Sprintf("There is no command %s.", args))
+		return
+	}
+	c.WriteLineToUser(fmt.Sprintf("%s - %s", cmd.Usage(), cmd.Help))
+	if len(cmd.Aliases) > 0 {
+		c.WriteLineToUser("Also: " + strings.Join(cmd.Aliases, ", "))
+	}
+}
+
+func quitCommand(c *Client, server *Server, args string) {
+	atomic.StoreInt32(&c.quit, 1)
+	server.OnExit(c)
+	c.Close()
+}
+
+func reloadCommand(c *Client, server *Server, args string) {
+	err := server.Reload()
+	if verr, ok := err.(*ValidationError); ok {
+		c.WriteLineToUser(fmt.Sprintf("Nothing reloaded, %d problem(s) in the levels:", len(verr.Problems)))
+		for _, problem := range verr.Problems {
+			c.WriteLineToUser(" • " + problem.String())
+		}
+		return
+	}
+	if err != nil {
+		c.WriteLineToUser(fmt.Sprintf("Nothing reloaded: %s", err))
+		return
+	}
+	c.WriteLineToUser(fmt.Sprintf("Reloaded the config and %d levels.", len(server.Levels())))
+}
+
+func setPasswordCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteLineToUser("Set whose password? (setpassword <nick>)")
+		return
+	}
+	c.setPasswordOf(server, args)
+}
+
+// matchOneItem finds the item the user means, it tells the user if there
+// is none or more than one.
+func (c *Client) matchOneItem(items []Item, input string, missing string) (Item, bool) {
+	matches := MatchItems(uniqueItems(items), input)
+	switch len(matches) {
+	case 0:
+		c.WriteLineToUser(fmt.Sprintf(missing, input))
+		return Item{}, false
+	case 1:
+		return matches[0], true
+	}
+	c.WriteLineToUser(fmt.Sprintf("Which one do you mean: %s?", strings.Join(itemNames(matches), ", ")))
+	return Item{}, false
+}
+
+func getCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteLineToUser("Get what? (get <item>)")
+		return
+	}
+	room := c.Player.GetPosition()
+	item, ok := c.matchOneItem(server.ItemsInRoom(room), args, "There is no %s here.")
+	if !ok {
+		return
+	}
+	if !server.TakeItem(room, item.Key) {
+		c.WriteLineToUser(fmt.Sprintf("Somebody was faster, the %s is gone.", item.Name))
+		return
+	}
+	c.Player.AddItem(item.Key)
+	server.SavePlayer(c.Player)
+	c.WriteLineToUser(fmt.Sprintf("You pick up the %s.", item.Name))
+	server.Hub.RoomExcept(room, c.Player.Nickname, fmt.Sprintf("%s picks up the %s", c.Player.Gamename, item.Name))
+}
+
+func dropCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteLineToUser("Drop what? (drop <item>)")
+		return
+	}
+	item, ok := c.matchOneItem(server.Inventory(c.Player), args, "You do not carry %s.")
+	if !ok || !c.Player.RemoveItem(item.Key) {
+		return
+	}
+	room := c.Player.GetPosition()
+	server.PutItem(room, item.Key)
+	server.SavePlayer(c.Player)
+	c.WriteLineToUser(fmt.Sprintf("You drop the %s.", item.Name))
+	server.Hub.RoomExcept(room, c.Player.Nickname, fmt.Sprintf("%s drops the %s", c.Player.Gamename, item.Name))
+}
+
+func timeCommand(c *Client, server *Server, args string) {
+	at := server.Moment()
+	c.WriteLineToUser(fmt.Sprintf("It is %s in the game, the %s phase of the day.", at.Game.Format("15:04"), Phase(at.Game)))
+	c.WriteLineToUser(fmt.Sprintf("In the world it is %s.", at.Now.Format("Mon 15:04 MST")))
+}
+
+func inventoryCommand(c *Client, server *Server, args string) {
+	items := server.Inventory(c.Player)
+	if len(items) == 0 {
+		c.WriteLineToUser("You carry nothing.")
+		return
+	}
+	c.WriteLineToUser("You carry:")
+	for _, item := range items {
+		c.WriteLineToUser(" • " + item.Name)
+	}
+}
+
+func examineCommand(c *Client, server *Server, args string) {
+	if args == "" {
+		c.WriteLineToUser("Examine what? (examine <item>)")
+		return
+	}
+	items := append(server.Inventory(c.Player), server.ItemsInRoom(c.Player.GetPosition())...)
+	item, ok := c.matchOneItem(items, args, "There is no %s here.")
+	if !ok {
+		return
+	}
+	if item.Description == "" {
+		c.WriteMessageToUser(fmt.Sprintf("Just a %s.", item.Name))
+		return
+	}
+	c.WriteMessageToUser(item.Description)
+}
+
+// uniqueItems removes items with the same key, carrying one and seeing the
+// same in the room is not ambiguous.
+func uniqueItems(items []Item) []Item {
+	seen := make(map[string]bool)
+	var unique []Item
+	for _, item := range items {
+		if !seen[item.Key] {
+			seen[item.Key] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,55 @@
+package game
+
+import "strings"
+
+// directionShortcuts maps the usual abbreviations to the direction names
+// used in the level files.
+var directionShortcuts = map[string]string{
+	"n":  "north",
+	"s":  "south",
+	"e":  "east",
+	"w":  "west",
+	"ne": "northeast",
+	"nw": "northwest",
+	"se": "southeast",
+	"sw": "southwest",
+	"u":  "up",
+	"d":  "down",
+}
+
+// normalizeDirection lower cases a direction name and removes separators,
+// so "North-East", "north east" and "northeast" are the same.
+func normalizeDirection(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Replace(name, "-", "", -1)
+	name = strings.Replace(name, " ", "", -1)
+	return name
+}
+
+// ExpandDirection turns a shortcut like "ne" into the full direction name,
+// other words are returned normalized.
+func ExpandDirection(word string) string {
+	word = normalizeDirection(word)
+	if full, ok := directionShortcuts[word]; ok {
+		return full
+	}
+	return word
+}
+
+// IsDirectionWord reports whether word is a compass direction, up, down or
+// one of their shortcuts.
+func IsDirectionWord(word string) bool {
+	full := ExpandDirection(word)
+	for _, direction := range directionShortcuts {
+		if direction == full {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesDirection reports whether the user input names the direction,
+// either in full or by its shortcut.
+func MatchesDirection(direction string, input string) bool {
+	return normalizeDirection(direction) == ExpandDirection(input)
+}
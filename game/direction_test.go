@@ -0,0 +1,43 @@
+package game
+
+import "testing"
+
+var directionTests = []struct {
+	direction string
+	input     string
+	out       bool
+}{
+	{"North", "north", true},
+	{"North", "NORTH", true},
+	{"North", "n", true},
+	{"Northeast", "ne", true},
+	{"North-East", "ne", true},
+	{"Northeast", "north east", true},
+	{"Up", "u", true},
+	{"Down", "d", true},
+	{"North", "ne", false},
+	{"North", "s", false},
+	{"North", "nor", false},
+	{"Elevator", "elevator", true},
+}
+
+func TestMatchesDirection(t *testing.T) {
+	for _, tt := range directionTests {
+		if MatchesDirection(tt.direction, tt.input) != tt.out {
+			t.Errorf("tests for direction %q with input %q failed, should be %v", tt.direction, tt.input, tt.out)
+		}
+	}
+}
+
+func TestIsDirectionWord(t *testing.T) {
+	for _, word := range []string{"n", "sw", "West", "up", "D", "southeast"} {
+		if !IsDirectionWord(word) {
+			t.Errorf("%q should be a direction", word)
+		}
+	}
+	for _, word := range []string{"look", "x", "", "elevator"} {
+		if IsDirectionWord(word) {
+			t.Errorf("%q should not be a direction", word)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// Effect changes the player when an action succeeds. The type selects what
+// is changed, Key names it and Op how:
+//
+//	attribute  add (default), subtract or set the attribute Key by Value
+//	action     grant (default) or revoke the action flag Key
+//	teleport   move the player to the station Key
+//	item       give (default) or take the item Key
+type Effect struct {
+	Type  string `xml:"type,attr"`
+	Key   string `xml:"key,attr"`
+	Op    string `xml:"op,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// effectOps lists the valid operations of each effect type, the first one
+// is the default.
+var effectOps = map[string][]string{
+	"attribute": {"add", "subtract", "set"},
+	"action":    {"grant", "revoke"},
+	"teleport":  {""},
+	"item":      {"give", "take"},
+}
+
+// op returns the operation of the effect with the default filled in.
+func (e Effect) op() string {
+	if e.Op == "" {
+		if ops, ok := effectOps[e.Type]; ok {
+			return ops[0]
+		}
+	}
+	return e.Op
+}
+
+// validate checks type, operation and value of the effect.
+func (e Effect) validate() error {
+	ops, ok := effectOps[e.Type]
+	if !ok {
+		return fmt.Errorf("unknown effect type %q", e.Type)
+	}
+	valid := false
+	for _, op := range ops {
+		valid = valid || op == e.op()
+	}
+	if !valid {
+		return fmt.Errorf("unknown %s effect operation %q", e.Type, e.Op)
+	}
+	if e.Key == "" {
+		return fmt.Errorf("%s effect needs a key", e.Type)
+	}
+	if e.Type == "attribute" {
+		if _, err := strconv.ParseInt(e.Value, 10, 64); err != nil {
+			return fmt.Errorf("attribute effect value %q is not a number", e.Value)
+		}
+	}
+	return nil
+}
+
+// applyEffects changes the player of c, invalid effects are skipped.
+func (c *Client) applyEffects(server *Server, effects []Effect) {
+	for _, e := range effects {
+		if err := e.validate(); err != nil {
+			log.Printf("Skipping effect: %s", err)
+			continue
+		}
+		switch e.Type {
+		case "attribute":
+			value, _ := strconv.ParseInt(e.Value, 10, 64)
+			switch e.op() {
+			case "add":
+				c.Player.UpdateAttribute(e.Key, value)
+			case "subtract":
+				c.Player.UpdateAttribute(e.Key, -value)
+			case "set":
+				c.Player.SetAttribute(e.Key, value)
+			}
+		case "action":
+			if e.op() == "revoke" {
+				c.Player.RevokeAction(e.Key)
+			} else {
+				c.Player.LogAction(e.Key)
+			}
+		case "teleport":
+			target, ok := server.GetRoom(e.Key)
+			if !ok {
+				log.Printf("Skipping effect: unknown station %q", e.Key)
+				continue
+			}
+			c.enterRoom(server, target,
+				fmt.Sprintf("%s vanishes", c.Player.Gamename),
+				fmt.Sprintf("%s appears out of nowhere", c.Player.Gamename))
+		case "item":
+			if e.op() == "take" {
+				c.Player.RemoveItem(e.Key)
+			} else {
+				c.Player.AddItem(e.Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package game
+
+import (
+	"os"
+	"testing"
+)
+
+var effectTests = []struct {
+	effect Effect
+	valid  bool
+}{
+	{Effect{Type: "attribute", Key: "strength", Value: "5"}, true},
+	{Effect{Type: "attribute", Key: "strength", Op: "set", Value: "-5"}, true},
+	{Effect{Type: "attribute", Key: "strength", Op: "multiply", Value: "5"}, false},
+	{Effect{Type: "attribute", Key: "strength", Value: "five"}, false},
+	{Effect{Type: "attribute", Value: "5"}, false},
+	{Effect{Type: "action", Key: "A:solder", Op: "revoke"}, true},
+	{Effect{Type: "action", Key: "A:solder", Op: "take"}, false},
+	{Effect{Type: "teleport", Key: "B"}, true},
+	{Effect{Type: "teleport", Key: "B", Op: "give"}, false},
+	{Effect{Type: "item", Key: "iron", Op: "take"}, true},
+	{Effect{Type: "spell", Key: "fireball"}, false},
+}
+
+func TestEffectValidate(t *testing.T) {
+	for _, tt := range effectTests {
+		if err := tt.effect.validate(); (err == nil) != tt.valid {
+			t.Errorf("tests for effect %+v failed, should be valid %v, got %v", tt.effect, tt.valid, err)
+		}
+	}
+}
+
+func TestClientActionEffects(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	a, _ := s.GetRoom("A")
+	a.Actions = []Action{
+		{Name: "train", Effects: []Effect{
+			{Type: "attribute", Key: "strength", Value: "5"},
+			{Type: "attribute", Key: "strength", Op: "subtract", Value: "2"},
+			{Type: "attribute", Key: "wisdom", Op: "set", Value: "7"},
+			{Type: "action", Key: "trained"},
+			{Type: "action", Key: "lazy", Op: "revoke"},
+			{Type: "item", Key: "medal"},
+			{Type: "item", Key: "ticket", Op: "take"},
+		}},
+		{Name: "lift", Dependencies: []Dependency{
+			{Key: "strength", Type: "attribute", MinValue: "3", MaxValue: "4", FailMessage: "Too weak."},
+		}, Effects: []Effect{
+			{Type: "teleport", Key: "B"},
+		}},
+	}
+	s.addLevel(a)
+
+	player := &Player{Nickname: "alice", Position: "A", ActionLog: []string{"lazy"}, Inventory: []string{"ticket"}}
+	runTestSessionOutput(s, player, "lift\n")
+	if player.GetPosition() != "A" {
+		t.Error("Effects should not apply when the dependencies fail")
+	}
+
+	runTestSessionOutput(s, player, "train\nlift\n")
+	if player.GetAttribute("strength") != 3 || player.GetAttribute("wisdom") != 7 {
+		t.Errorf("Attribute effects should apply, got %v", player.Attributes)
+	}
+	if !player.HasAction("trained") || player.HasAction("lazy") {
+		t.Errorf("Action effects should apply, got %v", player.ActionLog)
+	}
+	if !player.HasItem("medal") || player.HasItem("ticket") {
+		t.Errorf("Item effects should apply, got %v", player.Inventory)
+	}
+	if player.GetPosition() != "B" || !player.HasAction("B") {
+		t.Errorf("Teleport effects should move the player, got %q", player.GetPosition())
+	}
+}
@@ -0,0 +1,614 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Expression is a parsed condition of a dependency, e.g.
+//
+//	attr("karma") >= 3 && has("cbase-mainhall:nerding") && hour() in 20..4
+//
+// It knows integers, strings, true and false, the operators
+// || && ! == != < <= > >= + - * / %, parentheses, ranges "x in a..b"
+// (inclusive, wrapping around when a > b) and these functions:
+//
+//	has(key)     the player entered the level or did the action key
+//	item(key)    the player carries the item key
+//	attr(name)   the value of the attribute name
+//	hour()       the hour of the day, 0 to 23
+//	minute()     the minute of the hour, 0 to 59
+//	weekday()    the day of the week, 0 is sunday
+//	gamehour()   the hour of the in-game day, 0 to 23
+//	gameminute() the minute of the in-game hour, 0 to 59
+//	phase()      the phase of the in-game day, "dawn", "day", "dusk" or "night"
+//
+// Expressions are type checked when they are parsed, so a running server
+// only fails on division by zero.
+type Expression struct {
+	source string
+	root   *exprNode
+}
+
+// ExpressionError is a parse error, Pos is the byte offset in Source.
+type ExpressionError struct {
+	Source  string
+	Pos     int
+	Message string
+}
+
+func (e *ExpressionError) Error() string {
+	column := e.Pos + 1
+	if e.Pos <= len(e.Source) {
+		column = utf8.RuneCountInString(e.Source[:e.Pos]) + 1
+	}
+	return fmt.Sprintf("%s at column %d of expression %q", e.Message, column, e.Source)
+}
+
+type exprType int
+
+const (
+	exprInt exprType = iota
+	exprBool
+	exprString
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprInt:
+		return "number"
+	case exprBool:
+		return "true or false"
+	}
+	return "string"
+}
+
+// exprFunction is a function expressions can call.
+type exprFunction struct {
+	args   []exprType
+	result exprType
+	call   func(player *Player, at Moment, args []interface{}) interface{}
+}
+
+var exprFunctions = map[string]exprFunction{
+	"has": {[]exprType{exprString}, exprBool, func(player *Player, at Moment, args []interface{}) interface{} {
+		return player.HasAction(args[0].(string))
+	}},
+	"item": {[]exprType{exprString}, exprBool, func(player *Player, at Moment, args []interface{}) interface{} {
+		return player.HasItem(args[0].(string))
+	}},
+	"attr": {[]exprType{exprString}, exprInt, func(player *Player, at Moment, args []interface{}) interface{} {
+		return player.GetAttribute(args[0].(string))
+	}},
+	"hour": {nil, exprInt, func(player *Player, at Moment, args []interface{}) interface{} {
+		return int64(at.Now.Hour())
+	}},
+	"minute": {nil, exprInt, func(player *Player, at Moment, args []interface{}) interface{} {
+		return int64(at.Now.Minute())
+	}},
+	"weekday": {nil, exprInt, func(player *Player, at Moment, args []interface{}) interface{} {
+		return int64(at.Now.Weekday())
+	}},
+	"gamehour": {nil, exprInt, func(player *Player, at Moment, args []interface{}) interface{} {
+		return int64(at.Game.Hour())
+	}},
+	"gameminute": {nil, exprInt, func(player *Player, at Moment, args []interface{}) interface{} {
+		return int64(at.Game.Minute())
+	}},
+	"phase": {nil, exprString, func(player *Player, at Moment, args []interface{}) interface{} {
+		return Phase(at.Game)
+	}},
+}
+
+func exprFunctionNames() []string {
+	names := make([]string, 0, len(exprFunctions))
+	for name := range exprFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exprNode is a node of the syntax tree. Literals carry value, calls name
+// the function in op and operators their operands in args.
+type exprNode struct {
+	op    string
+	typ   exprType
+	value interface{}
+	args  []*exprNode
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+// ParseExpression parses and type checks a condition.
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{source: source, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.errorf(t.pos, "unexpected %s", t)
+	}
+	if root.typ != exprBool {
+		return nil, p.errorf(0, "expression has to be true or false, not a %s", root.typ)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression for player at the moment at.
+func (e *Expression) Eval(player *Player, at Moment) (bool, error) {
+	value, err := e.root.eval(player, at)
+	if err != nil {
+		return false, fmt.Errorf("expression %q: %v", e.source, err)
+	}
+	return value.(bool), nil
+}
+
+// Keys lists the string arguments of the calls to function name, e.g. the
+// action keys has() asks for.
+func (e *Expression) Keys(name string) []string {
+	var keys []string
+	var walk func(n *exprNode)
+	walk = func(n *exprNode) {
+		if n.op == name && len(n.args) == 1 && n.args[0].op == "literal" {
+			keys = append(keys, n.args[0].value.(string))
+		}
+		for _, arg := range n.args {
+			walk(arg)
+		}
+	}
+	walk(e.root)
+	return keys
+}
+
+func (n *exprNode) eval(player *Player, at Moment) (interface{}, error) {
+	switch n.op {
+	case "literal":
+		return n.value, nil
+	case "&&", "||":
+		left, err := n.args[0].eval(player, at)
+		if err != nil {
+			return nil, err
+		}
+		if left.(bool) == (n.op == "||") {
+			return left, nil
+		}
+		return n.args[1].eval(player, at)
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(player, at)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	if f, ok := exprFunctions[n.op]; ok {
+		return f.call(player, at, args), nil
+	}
+
+	switch n.op {
+	case "!":
+		return !args[0].(bool), nil
+	case "neg":
+		return -args[0].(int64), nil
+	case "==":
+		return args[0] == args[1], nil
+	case "!=":
+		return args[0] != args[1], nil
+	case "in":
+		x, from, to := args[0].(int64), args[1].(int64), args[2].(int64)
+		if from <= to {
+			return from <= x && x <= to, nil
+		}
+		return x >= from || x <= to, nil
+	}
+
+	if n.args[0].typ == exprString {
+		a, b := args[0].(string), args[1].(string)
+		switch n.op {
+		case "+":
+			return a + b, nil
+		case "<":
+			return a < b, nil
+		case "<=":
+			return a <= b, nil
+		case ">":
+			return a > b, nil
+		case ">=":
+			return a >= b, nil
+		}
+	}
+
+	a, b := args[0].(int64), args[1].(int64)
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			return nil, errDivisionByZero
+		}
+		if n.op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenInt
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// exprOperators are the operator tokens, longer ones first.
+var exprOperators = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "..",
+	"!", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",",
+}
+
+func lexExpression(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	fail := func(pos int, format string, args ...interface{}) error {
+		return &ExpressionError{Source: source, Pos: pos, Message: fmt.Sprintf(format, args...)}
+	}
+
+	for i := 0; i < len(source); {
+		c, size := utf8.DecodeRuneInString(source[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && source[i] >= '0' && source[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokenInt, source[start:i], start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(source) {
+				r, size := utf8.DecodeRuneInString(source[i:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, exprToken{tokenIdent, source[start:i], start})
+		case c == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(source) {
+					return nil, fail(start, "string is not terminated")
+				}
+				if source[i] == '"' {
+					i++
+					break
+				}
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				b.WriteByte(source[i])
+				i++
+			}
+			tokens = append(tokens, exprToken{tokenString, b.String(), start})
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, exprToken{tokenOperator, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				if c == '&' || c == '|' || c == '=' {
+					return nil, fail(i, "unknown operator '%c', did you mean '%c%c'", c, c, c)
+				}
+				return nil, fail(i, "unexpected character '%c'", c)
+			}
+		}
+	}
+	return append(tokens, exprToken{tokenEnd, "", len(source)}), nil
+}
+
+type exprParser struct {
+	source string
+	tokens []exprToken
+	next   int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) advance() exprToken {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators ops.
+func (p *exprParser) accept(ops ...string) (exprToken, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && !(t.kind == tokenIdent && t.text == "in") {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.advance(), true
+		}
+	}
+	return t, false
+}
+
+func (p *exprParser) expect(op string) error {
+	if t, ok := p.accept(op); !ok {
+		return p.errorf(t.pos, "expected '%s' but found %s", op, t)
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(pos int, format string, args ...interface{}) error {
+	return &ExpressionError{Source: p.source, Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// operand checks the type of an operand of the operator t.
+func (p *exprParser) operand(t exprToken, n *exprNode, typ exprType) error {
+	if n.typ != typ {
+		return p.errorf(t.pos, "%s needs a %s, not a %s", t, typ, n.typ)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (*exprNode, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (*exprNode, error) {
+	return p.parseLogical("&&", p.parseComparison)
+}
+
+func (p *exprParser) parseLogical(op string, operand func() (*exprNode, error)) (*exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(op)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range []*exprNode{left, right} {
+			if err := p.operand(t, n, exprBool); err != nil {
+				return nil, err
+			}
+		}
+		left = &exprNode{op: op, typ: exprBool, args: []*exprNode{left, right}}
+	}
+}
+
+func (p *exprParser) parseComparison() (*exprNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in")
+	if !ok {
+		return left, nil
+	}
+
+	if t.text == "in" {
+		from, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(".."); err != nil {
+			return nil, err
+		}
+		to, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range []*exprNode{left, from, to} {
+			if err := p.operand(t, n, exprInt); err != nil {
+				return nil, err
+			}
+		}
+		return &exprNode{op: "in", typ: exprBool, args: []*exprNode{left, from, to}}, nil
+	}
+
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if left.typ != right.typ {
+		return nil, p.errorf(t.pos, "can not compare a %s with a %s", left.typ, right.typ)
+	}
+	if left.typ == exprBool && t.text != "==" && t.text != "!=" {
+		return nil, p.errorf(t.pos, "%s can not compare true or false", t)
+	}
+	return &exprNode{op: t.text, typ: exprBool, args: []*exprNode{left, right}}, nil
+}
+
+func (p *exprParser) parseSum() (*exprNode, error) {
+	return p.parseArithmetic([]string{"+", "-"}, p.parseProduct)
+}
+
+func (p *exprParser) parseProduct() (*exprNode, error) {
+	return p.parseArithmetic([]string{"*", "/", "%"}, p.parseUnary)
+}
+
+func (p *exprParser) parseArithmetic(ops []string, operand func() (*exprNode, error)) (*exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		typ := exprInt
+		if t.text == "+" && left.typ == exprString {
+			typ = exprString
+		}
+		for _, n := range []*exprNode{left, right} {
+			if err := p.operand(t, n, typ); err != nil {
+				return nil, err
+			}
+		}
+		left = &exprNode{op: t.text, typ: typ, args: []*exprNode{left, right}}
+	}
+}
+
+func (p *exprParser) parseUnary() (*exprNode, error) {
+	if t, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "!" {
+			if err := p.operand(t, operand, exprBool); err != nil {
+				return nil, err
+			}
+			return &exprNode{op: "!", typ: exprBool, args: []*exprNode{operand}}, nil
+		}
+		if err := p.operand(t, operand, exprInt); err != nil {
+			return nil, err
+		}
+		return &exprNode{op: "neg", typ: exprInt, args: []*exprNode{operand}}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (*exprNode, error) {
+	t := p.advance()
+	switch t.kind {
+	case tokenInt:
+		value, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(t.pos, "number %s is too big", t.text)
+		}
+		return &exprNode{op: "literal", typ: exprInt, value: value}, nil
+	case tokenString:
+		return &exprNode{op: "literal", typ: exprString, value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &exprNode{op: "literal", typ: exprBool, value: t.text == "true"}, nil
+		}
+		return p.parseCall(t)
+	case tokenOperator:
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+	}
+	return nil, p.errorf(t.pos, "expected a value but found %s", t)
+}
+
+func (p *exprParser) parseCall(name exprToken) (*exprNode, error) {
+	f, ok := exprFunctions[name.text]
+	if !ok {
+		message := fmt.Sprintf("unknown function %s", name.text)
+		if question := didYouMean(Suggest(name.text, exprFunctionNames())); question != "" {
+			message += ". " + question
+		}
+		return nil, p.errorf(name.pos, "%s", message)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var args []*exprNode
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) != len(f.args) {
+		return nil, p.errorf(name.pos, "%s() takes %d argument(s), not %d", name.text, len(f.args), len(args))
+	}
+	for i, arg := range args {
+		if arg.typ != f.args[i] {
+			return nil, p.errorf(name.pos, "argument %d of %s() has to be a %s, not a %s", i+1, name.text, f.args[i], arg.typ)
+		}
+	}
+	return &exprNode{op: name.text, typ: f.result, args: args}, nil
+}
@@ -0,0 +1,198 @@
+package game
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var expressionTests = []struct {
+	source string
+	out    bool
+}{
+	{`true`, true},
+	{`!true`, false},
+	{`attr("karma") >= 3`, true},
+	{`attr("karma") > 3`, false},
+	{`attr("unknown") == 0`, true},
+	{`has("cbase-mainhall:nerding")`, true},
+	{`has("cbase-mainhall:sleeping")`, false},
+	{`item("iron") && !item("lamp")`, true},
+	{`attr("karma") >= 3 && has("cbase-mainhall:nerding") && hour() in 20..4`, true},
+	{`hour() in 20..23`, true},
+	{`hour() in 22..4`, false},
+	{`hour() in 0..4`, false},
+	{`minute() == 30 && weekday() == 5`, true},
+	{`attr("karma") * 2 - 1 == 5`, true},
+	{`attr("karma") % 2 == 1 && 7 / 2 == 3`, true},
+	{`-attr("karma") < 0`, true},
+	{`1 + 2 * 3 == 7`, true},
+	{`(1 + 2) * 3 == 9`, true},
+	{`false || true && false`, false},
+	{`(false || true) && true`, true},
+	{`"a" + "b" == "ab"`, true},
+	{`"abc" < "abd"`, true},
+	{`"say \"hi\"" != "say hi"`, true},
+	{`true == !false`, true},
+	{`false && 1 / 0 == 0`, false},
+	{`true || 1 / 0 == 0`, true},
+}
+
+func TestExpressionEval(t *testing.T) {
+	p := &Player{}
+	p.UpdateAttribute("karma", 3)
+	p.LogAction("cbase-mainhall:nerding")
+	p.AddItem("iron")
+	// a friday evening
+	now := time.Date(2016, 4, 1, 21, 30, 0, 0, time.UTC)
+
+	for _, tt := range expressionTests {
+		expression, err := ParseExpression(tt.source)
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		out, err := expression.Eval(p, Moment{Now: now, Game: now})
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if out != tt.out {
+			t.Errorf("%s is %v, should be %v", tt.source, out, tt.out)
+		}
+	}
+}
+
+var expressionErrorTests = []struct {
+	source string
+	pos    int
+	err    string
+}{
+	{``, 0, "expected a value but found end of expression"},
+	{`attr("karma")`, 0, "expression has to be true or false, not a number"},
+	{`attr("karma") >= `, 17, "expected a value but found end of expression"},
+	{`has("a") & has("b")`, 9, "unknown operator '&', did you mean '&&'"},
+	{`attr("karma") = 3`, 14, "unknown operator '=', did you mean '=='"},
+	{`atr("karma") > 1`, 0, "unknown function atr. Did you mean attr?"},
+	{`has("a", "b")`, 0, "has() takes 1 argument(s), not 2"},
+	{`attr(3) > 1`, 0, "argument 1 of attr() has to be a string, not a number"},
+	{`has("a") && 3`, 9, "'&&' needs a true or false, not a number"},
+	{`!attr("a")`, 0, "'!' needs a true or false, not a number"},
+	{`has("a") == 1`, 9, "can not compare a true or false with a number"},
+	{`has("a") < true`, 9, "'<' can not compare true or false"},
+	{`hour() in 20`, 12, "expected '..' but found end of expression"},
+	{`hour() in "a".."b"`, 7, "'in' needs a number, not a string"},
+	{`(has("a")`, 9, "expected ')' but found end of expression"},
+	{`has("a")) `, 8, "unexpected ')'"},
+	{`has("a) > 1`, 4, "string is not terminated"},
+	{`has("a") # 1`, 9, "unexpected character '#'"},
+	{`hour > 1`, 5, "expected '(' but found '>'"},
+	{`99999999999999999999 > 1`, 0, "number 99999999999999999999 is too big"},
+	{`has("a") → has("b")`, 9, "unexpected character '→'"},
+	{`größe() > 1`, 0, "unknown function größe"},
+	{`"ä" != "ö" # 1`, 13, "unexpected character '#'"},
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, tt := range expressionErrorTests {
+		_, err := ParseExpression(tt.source)
+		exprErr, ok := err.(*ExpressionError)
+		if !ok {
+			t.Errorf("%s: should fail with an ExpressionError, got %v", tt.source, err)
+			continue
+		}
+		if exprErr.Message != tt.err || exprErr.Pos != tt.pos {
+			t.Errorf("%s: got %q at %d, should be %q at %d", tt.source, exprErr.Message, exprErr.Pos, tt.err, tt.pos)
+		}
+	}
+}
+
+func TestExpressionErrorColumn(t *testing.T) {
+	_, err := ParseExpression(`"ä" # 1`)
+	if err == nil || !strings.Contains(err.Error(), "at column 5 ") {
+		t.Errorf("Columns should count characters, got %v", err)
+	}
+}
+
+func TestExpressionDivisionByZero(t *testing.T) {
+	expression, err := ParseExpression(`10 / attr("zero") > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expression.Eval(&Player{}, testMoment); err == nil || !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("Division by zero should fail, got %v", err)
+	}
+}
+
+func TestExpressionKeys(t *testing.T) {
+	expression, err := ParseExpression(`has("a") || has("b") && attr("c") > 0 || item("d")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := strings.Join(expression.Keys("has"), ","); keys != "a,b" {
+		t.Errorf("has() keys are %s, should be a,b", keys)
+	}
+	if keys := strings.Join(expression.Keys("attr"), ","); keys != "c" {
+		t.Errorf("attr() keys are %s, should be c", keys)
+	}
+}
+
+func TestCheckDependenciesExpression(t *testing.T) {
+	p := &Player{}
+	dependencies := []Dependency{{
+		Type:        "expression",
+		Expression:  `attr("karma") >= 3 || item("iron")`,
+		OkMessage:   "OK",
+		FailMessage: "FAIL",
+	}}
+
+	if ok, message := CheckDependencies(dependencies, p, "", testMoment); ok || message != "FAIL" {
+		t.Error("Should fail without karma or iron")
+	}
+	p.AddItem("iron")
+	if ok, message := CheckDependencies(dependencies, p, "", testMoment); !ok || message != "OK" {
+		t.Error("Should pass with iron")
+	}
+
+	// an expression adds to the check of the type
+	dependencies = []Dependency{{Key: "iron", Type: "item", Expression: `attr("karma") >= 3`}}
+	if ok, _ := CheckDependencies(dependencies, p, "", testMoment); ok {
+		t.Error("Should fail without karma")
+	}
+	p.UpdateAttribute("karma", 3)
+	if ok, _ := CheckDependencies(dependencies, p, "", testMoment); !ok {
+		t.Error("Should pass with iron and karma")
+	}
+
+	// without type and key only the expression is checked
+	dependencies = []Dependency{{Expression: `attr("karma") >= 3`}}
+	if ok, _ := CheckDependencies(dependencies, p, "", testMoment); !ok {
+		t.Error("Should pass with karma without a type")
+	}
+
+	dependencies = []Dependency{{Type: "expression", Expression: `attr("karma") >=`}}
+	if ok, _ := CheckDependencies(dependencies, p, "", testMoment); ok {
+		t.Error("Invalid expressions should not be met")
+	}
+}
+
+func TestReadLevelExpressionError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-mud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.lvl")
+	writeTestFile(t, path, `<station key="A" tag="default"><name>A</name>
+		<directions><direction><name>north</name><station>A</station>
+			<dependency type="expression"><expression>has("x") &amp;&amp; atr("y") > 1</expression></dependency>
+		</direction></directions></station>`)
+
+	_, err = readLevel(path)
+	if err == nil || !strings.Contains(err.Error(), "direction north: unknown function atr") {
+		t.Errorf("Loading should report the expression, got %v", err)
+	}
+}
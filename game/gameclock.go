@@ -0,0 +1,92 @@
+package game
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Phases of the in-game day.
+const (
+	PhaseDawn  = "dawn"
+	PhaseDay   = "day"
+	PhaseDusk  = "dusk"
+	PhaseNight = "night"
+)
+
+// phases are the phases of the in-game day with the hour they start at.
+var phases = []struct {
+	start int
+	name  string
+}{
+	{5, PhaseDawn},
+	{8, PhaseDay},
+	{18, PhaseDusk},
+	{21, PhaseNight},
+}
+
+// gameEpoch is the moment the game clock started, at this time of the world
+// the game time is the same.
+var gameEpoch = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Moment is the time dependencies are checked at: Now is the time of the
+// world, Game the in-game time.
+type Moment struct {
+	Now  time.Time
+	Game time.Time
+}
+
+// GameTime returns the in-game time at the world time now. The game clock
+// runs GameTimeRatio times as fast as the world clock, it shows the same
+// time as the world when the ratio is 1 or not set.
+func (c ServerConfig) GameTime(now time.Time) time.Time {
+	ratio := c.GameTimeRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	// the game has no time zone, it starts at midnight of the world
+	wall := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), time.UTC)
+	seconds := wall.Sub(gameEpoch).Seconds() * ratio
+	days := math.Floor(seconds / 86400)
+	rest := time.Duration((seconds - days*86400) * float64(time.Second))
+	return gameEpoch.AddDate(0, 0, int(days)).Add(rest)
+}
+
+// Phase returns the phase of the in-game day at the game time t.
+func Phase(t time.Time) string {
+	phase := phases[len(phases)-1].name
+	for _, p := range phases {
+		if t.Hour() >= p.start {
+			phase = p.name
+		}
+	}
+	return phase
+}
+
+// isPhase reports whether phase is one of the comma separated phases.
+func isPhase(phases string, phase string) bool {
+	for _, p := range strings.Split(phases, ",") {
+		if strings.EqualFold(strings.TrimSpace(p), phase) {
+			return true
+		}
+	}
+	return false
+}
+
+// validPhase reports whether name is a phase of the in-game day.
+func validPhase(name string) bool {
+	for _, p := range phases {
+		if strings.EqualFold(strings.TrimSpace(name), p.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Moment returns the world time and in-game time dependencies are checked
+// at.
+func (s *Server) Moment() Moment {
+	config := s.GetConfig()
+	now := s.Clock().In(config.Location())
+	return Moment{Now: now, Game: config.GameTime(now)}
+}
@@ -0,0 +1,126 @@
+package game
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var gameTimeTests = []struct {
+	ratio float64
+	now   time.Time
+	game  string
+}{
+	{0, time.Date(2016, 4, 1, 21, 30, 0, 0, time.UTC), "2016-04-01 21:30"},
+	{1, time.Date(2016, 4, 1, 21, 30, 0, 0, time.UTC), "2016-04-01 21:30"},
+	{12, time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), "2016-01-01 00:00"},
+	{12, time.Date(2016, 1, 1, 1, 0, 0, 0, time.UTC), "2016-01-01 12:00"},
+	{12, time.Date(2016, 1, 1, 2, 5, 0, 0, time.UTC), "2016-01-02 01:00"},
+	{24, time.Date(2016, 1, 2, 0, 30, 0, 0, time.UTC), "2016-01-25 12:00"},
+	{0.5, time.Date(2016, 1, 2, 12, 0, 0, 0, time.UTC), "2016-01-01 18:00"},
+	// the game starts at midnight of the world, whatever its time zone
+	{12, time.Date(2016, 1, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600)), "2016-01-01 12:00"},
+	// fast clocks do not overflow
+	{1000, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), "16017-08-28 00:00"},
+}
+
+func TestGameTime(t *testing.T) {
+	for _, tt := range gameTimeTests {
+		config := ServerConfig{GameTimeRatio: tt.ratio}
+		if game := config.GameTime(tt.now).Format("2006-01-02 15:04"); game != tt.game {
+			t.Errorf("Game time at %s with ratio %v is %s, should be %s", tt.now, tt.ratio, game, tt.game)
+		}
+	}
+}
+
+var phaseTests = []struct {
+	clock string
+	phase string
+}{
+	{"00:00", PhaseNight},
+	{"04:59", PhaseNight},
+	{"05:00", PhaseDawn},
+	{"07:59", PhaseDawn},
+	{"08:00", PhaseDay},
+	{"17:59", PhaseDay},
+	{"18:00", PhaseDusk},
+	{"20:59", PhaseDusk},
+	{"21:00", PhaseNight},
+	{"23:59", PhaseNight},
+}
+
+func TestPhase(t *testing.T) {
+	for _, tt := range phaseTests {
+		at, _ := time.Parse("15:04", tt.clock)
+		if phase := Phase(at); phase != tt.phase {
+			t.Errorf("Phase at %s is %s, should be %s", tt.clock, phase, tt.phase)
+		}
+	}
+}
+
+var gameTimeDependencyTests = []struct {
+	dependency Dependency
+	out        bool
+}{
+	{Dependency{Type: "gametime", Key: "night"}, true},
+	{Dependency{Type: "gametime", Key: "Night"}, true},
+	{Dependency{Type: "gametime", Key: "day"}, false},
+	{Dependency{Type: "gametime", Key: "dusk, night"}, true},
+	{Dependency{Type: "gametime", Key: "dawn,day"}, false},
+	{Dependency{Type: "gametime", MinValue: "22:00", MaxValue: "02:00"}, true},
+	{Dependency{Type: "gametime", MinValue: "08:00", MaxValue: "18:00"}, false},
+	{Dependency{Type: "gametime", Key: "night", MinValue: "23:00", MaxValue: "23:59"}, true},
+	{Dependency{Type: "gametime", Key: "night", MinValue: "00:00", MaxValue: "01:00"}, false},
+	{Dependency{Type: "gametime", Key: "night", Days: "sun"}, true},
+	{Dependency{Type: "gametime", Days: "mon-fri"}, false},
+	{Dependency{Type: "gametime"}, false},
+	// the world time is day
+	{Dependency{Type: "time", MinValue: "12:00", MaxValue: "13:00"}, true},
+	{Dependency{Type: "expression", Expression: `phase() == "night" && gamehour() == 23 && gameminute() == 15 && hour() == 12`}, true},
+}
+
+func TestCheckDependenciesGameTime(t *testing.T) {
+	p := &Player{}
+	// sunday night in the game, friday noon in the world
+	at := Moment{
+		Now:  time.Date(2016, 4, 1, 12, 30, 0, 0, time.UTC),
+		Game: time.Date(2016, 4, 3, 23, 15, 0, 0, time.UTC),
+	}
+	for _, tt := range gameTimeDependencyTests {
+		if ok, _ := CheckDependencies([]Dependency{tt.dependency}, p, "", at); ok != tt.out {
+			t.Errorf("%+v should be %v", tt.dependency, tt.out)
+		}
+	}
+}
+
+func TestServerTimeCommand(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	s.Config.GameTimeRatio = 12
+	s.Config.location = time.UTC
+	s.Clock = func() time.Time {
+		return time.Date(2016, 1, 1, 1, 45, 0, 0, time.UTC)
+	}
+
+	a, _ := s.GetRoom("A")
+	a.Messages = []Message{
+		{Text: "The sun is shining.", Dependencies: []Dependency{{Type: "gametime", Key: "day"}}},
+		{Text: "The stars are out.", Dependencies: []Dependency{{Type: "gametime", Key: "night"}}},
+	}
+	s.addLevel(a)
+
+	output := runTestSessionOutput(s, &Player{Nickname: "clock", Position: "B"}, "time\nwest\n")
+	for _, expected := range []string{
+		"It is 21:00 in the game, the night phase of the day.",
+		"In the world it is Fri 01:45 UTC.",
+		"The stars are out.",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Output should contain %q, got %q", expected, output)
+		}
+	}
+	if strings.Contains(output, "The sun is shining.") {
+		t.Error("Messages of other phases should not be shown")
+	}
+}
@@ -0,0 +1,305 @@
+package game
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hub routes chat messages to the connected clients. It reads the room of
+// every client from its player so that say and emote only reach the
+// players nearby. The clients are registered by their nickname.
+type Hub struct {
+	lock    sync.RWMutex
+	clients map[string]*hubClient
+}
+
+type hubClient struct {
+	client     *Client
+	lastTell   string
+	since      time.Time
+	lastActive time.Time
+	// linkDead runs while the connection is lost, the session is removed
+	// when it fires
+	linkDead *time.Timer
+}
+
+// takeoverTimeout limits how long the goodbye message to a taken over
+// connection may block.
+const takeoverTimeout = time.Second
+
+// Presence describes a connected player.
+type Presence struct {
+	Nickname   string
+	Gamename   string
+	PlayerType string
+	Room       string
+	Since      time.Time
+	LastActive time.Time
+	LinkDead   bool
+}
+
+// Idle is the time since the player typed the last command.
+func (p Presence) Idle() time.Duration {
+	return time.Since(p.LastActive)
+}
+
+func (hc *hubClient) presence() Presence {
+	player := hc.client.Player
+	return Presence{
+		Nickname:   player.Nickname,
+		Gamename:   player.Gamename,
+		PlayerType: player.PlayerType,
+		Room:       player.GetPosition(),
+		Since:      hc.since,
+		LastActive: hc.lastActive,
+		LinkDead:   hc.linkDead != nil,
+	}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[string]*hubClient),
+	}
+}
+
+// Join registers a client under the nickname of its player. If the player
+// has a session already, c takes it over: a link dead session is resumed,
+// the connection of a live one is closed. Join reports whether an existing
+// session was taken over.
+func (h *Hub) Join(c *Client) bool {
+	log.Printf("New client: %s (%v)", c.Player.Nickname, c.Conn.RemoteAddr())
+	h.lock.Lock()
+	now := time.Now()
+	hc, ok := h.clients[c.Player.Nickname]
+	if !ok {
+		h.clients[c.Player.Nickname] = &hubClient{
+			client:     c,
+			since:      now,
+			lastActive: now,
+		}
+		h.lock.Unlock()
+		return false
+	}
+
+	old := hc.client
+	hc.client = c
+	hc.lastActive = now
+	wasLinkDead := hc.linkDead != nil
+	if wasLinkDead {
+		hc.linkDead.Stop()
+		hc.linkDead = nil
+	}
+	h.lock.Unlock()
+
+	if !wasLinkDead {
+		log.Printf("Session of %s taken over from %v", c.Player.Nickname, old.Conn.RemoteAddr())
+		old.Conn.SetWriteDeadline(now.Add(takeoverTimeout))
+		old.WriteLineToUser("Your session was taken over by a new connection.")
+		old.Close()
+	}
+	return true
+}
+
+// Leave removes the session of c right away. It reports false if the
+// session was taken over by another client in the meantime.
+func (h *Hub) Leave(c *Client) bool {
+	log.Printf("Client disconnects: %s (%v)", c.Player.Nickname, c.Conn.RemoteAddr())
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hc, ok := h.clients[c.Player.Nickname]
+	if !ok || hc.client != c {
+		return false
+	}
+	if hc.linkDead != nil {
+		hc.linkDead.Stop()
+	}
+	delete(h.clients, c.Player.Nickname)
+	return true
+}
+
+// Drop keeps the session of c after its connection was lost, so the player
+// can reconnect into it within grace. When grace runs out the session is
+// removed and expired is called.
+func (h *Hub) Drop(c *Client, grace time.Duration, expired func()) {
+	log.Printf("Link lost: %s (%v)", c.Player.Nickname, c.Conn.RemoteAddr())
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hc, ok := h.clients[c.Player.Nickname]
+	if !ok || hc.client != c {
+		return
+	}
+	hc.linkDead = time.AfterFunc(grace, func() {
+		h.lock.Lock()
+		current, ok := h.clients[c.Player.Nickname]
+		gone := ok && current == hc && hc.client == c && hc.linkDead != nil
+		if gone {
+			delete(h.clients, c.Player.Nickname)
+		}
+		h.lock.Unlock()
+
+		if gone {
+			log.Printf("Link dead session of %s expired", c.Player.Nickname)
+			expired()
+		}
+	})
+}
+
+// Disconnect ends every session, connected clients get msg before their
+// connection is closed.
+func (h *Hub) Disconnect(msg string) {
+	h.lock.Lock()
+	clients := h.clients
+	h.clients = make(map[string]*hubClient)
+	h.lock.Unlock()
+
+	for _, hc := range clients {
+		if hc.linkDead != nil {
+			hc.linkDead.Stop()
+			continue
+		}
+		hc.client.Conn.SetWriteDeadline(time.Now().Add(takeoverTimeout))
+		hc.client.WriteLineToUser(msg)
+		hc.client.Close()
+	}
+}
+
+// Touch marks a client as active, it resets the idle time.
+func (h *Hub) Touch(c *Client) {
+	h.lock.Lock()
+	if hc, ok := h.clients[c.Player.Nickname]; ok {
+		hc.lastActive = time.Now()
+	}
+	h.lock.Unlock()
+}
+
+// Online lists all connected players sorted by nickname.
+func (h *Hub) Online() []Presence {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	online := make([]Presence, 0, len(h.clients))
+	for _, hc := range h.clients {
+		online = append(online, hc.presence())
+	}
+	sort.Slice(online, func(i, j int) bool {
+		return strings.ToLower(online[i].Nickname) < strings.ToLower(online[j].Nickname)
+	})
+	return online
+}
+
+// IsOnline looks up a connected player by nickname.
+func (h *Hub) IsOnline(nickname string) (Presence, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if hc, ok := h.find(nickname); ok {
+		return hc.presence(), true
+	}
+	return Presence{}, false
+}
+
+// find looks up a client by nickname, an exact match wins over a case
+// insensitive one. The caller has to hold the lock.
+func (h *Hub) find(nickname string) (*hubClient, bool) {
+	if hc, ok := h.clients[nickname]; ok {
+		return hc, true
+	}
+	for nick, hc := range h.clients {
+		if strings.EqualFold(nick, nickname) {
+			return hc, true
+		}
+	}
+	return nil, false
+}
+
+// Tell sends a private message from one client to the player with the given
+// nickname. It returns the nickname of the receiver and false if nobody
+// with that nickname is connected.
+func (h *Hub) Tell(from *Client, nickname string, msg string) (string, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hc, ok := h.find(nickname)
+	if !ok || hc.linkDead != nil {
+		return "", false
+	}
+	hc.lastTell = from.Player.Nickname
+	deliver(hc.client, msg)
+	return hc.client.Player.Nickname, true
+}
+
+// Send delivers msg to the player with the given nickname, it reports
+// false if the player is not connected.
+func (h *Hub) Send(nickname string, msg string) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	hc, ok := h.clients[nickname]
+	if !ok || hc.linkDead != nil {
+		return false
+	}
+	deliver(hc.client, msg)
+	return true
+}
+
+// LastTell returns the nickname of the last player who sent c a private
+// message.
+func (h *Hub) LastTell(c *Client) string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if hc, ok := h.clients[c.Player.Nickname]; ok {
+		return hc.lastTell
+	}
+	return ""
+}
+
+// Room sends msg to every client in room, link dead sessions miss it.
+func (h *Hub) Room(room string, msg string) {
+	h.RoomExcept(room, "", msg)
+}
+
+// RoomExcept sends msg to every client in room but the one with the given
+// nickname.
+func (h *Hub) RoomExcept(room string, nickname string, msg string) {
+	log.Printf("New message in %s: %s", room, msg)
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for nick, hc := range h.clients {
+		if nick != nickname && hc.linkDead == nil && hc.client.Player.GetPosition() == room {
+			deliver(hc.client, msg)
+		}
+	}
+}
+
+// InRoom lists the players in room sorted by nickname.
+func (h *Hub) InRoom(room string) []Presence {
+	var present []Presence
+	for _, p := range h.Online() {
+		if p.Room == room {
+			present = append(present, p)
+		}
+	}
+	return present
+}
+
+// Broadcast sends msg to every connected client.
+func (h *Hub) Broadcast(msg string) {
+	log.Printf("New message: %s", msg)
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for _, hc := range h.clients {
+		if hc.linkDead == nil {
+			deliver(hc.client, msg)
+		}
+	}
+}
+
+// deliver queues msg for the writer of the client without blocking the hub,
+// the messages keep their order. When the queue is full because the client
+// does not read, msg is dropped.
+func deliver(c *Client, msg string) {
+	select {
+	case c.Ch <- "\033[1;33;40m" + msg + "\033[m\n\r":
+	default:
+		log.Printf("Message to %s dropped, the queue is full", c.Nickname)
+	}
+}
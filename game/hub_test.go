@@ -0,0 +1,294 @@
+package game
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func makeHubClient(nick string, room string) *Client {
+	conn, peer := net.Pipe()
+	go io.Copy(ioutil.Discard, peer)
+	return NewClient(conn, &Player{Nickname: nick, Position: room})
+}
+
+func expectMessage(t *testing.T, c *Client, msg string) {
+	select {
+	case got := <-c.Ch:
+		if got != "\033[1;33;40m"+msg+"\033[m\n\r" {
+			t.Errorf("%s got %q, should get %q", c.Nickname, got, msg)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("%s should get %q", c.Nickname, msg)
+	}
+}
+
+func expectNoMessage(t *testing.T, c *Client) {
+	select {
+	case got := <-c.Ch:
+		t.Errorf("%s should not get %q", c.Nickname, got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHubDeliversInOrder(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	h.Join(alice)
+
+	for i := 0; i < outboundQueueSize; i++ {
+		h.Send("alice", fmt.Sprintf("message %d", i))
+	}
+	for i := 0; i < outboundQueueSize; i++ {
+		expectMessage(t, alice, fmt.Sprintf("message %d", i))
+	}
+}
+
+func TestHubDropsWhenQueueIsFull(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	h.Join(alice)
+
+	sent := make(chan bool)
+	go func() {
+		for i := 0; i < outboundQueueSize+10; i++ {
+			h.Send("alice", fmt.Sprintf("message %d", i))
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Sending should not block when the client does not read")
+	}
+	for i := 0; i < outboundQueueSize; i++ {
+		expectMessage(t, alice, fmt.Sprintf("message %d", i))
+	}
+	expectNoMessage(t, alice)
+}
+
+func TestHubRoom(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	bob := makeHubClient("bob", "alex")
+	carol := makeHubClient("carol", "ostkreuz")
+	h.Join(alice)
+	h.Join(bob)
+	h.Join(carol)
+
+	h.Room("alex", "hello")
+	expectMessage(t, alice, "hello")
+	expectMessage(t, bob, "hello")
+	expectNoMessage(t, carol)
+
+	carol.Player.SetPosition("alex")
+	bob.Player.SetPosition("ostkreuz")
+	h.Room("alex", "again")
+	expectMessage(t, alice, "again")
+	expectMessage(t, carol, "again")
+	expectNoMessage(t, bob)
+}
+
+func TestHubBroadcast(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	bob := makeHubClient("bob", "ostkreuz")
+	h.Join(alice)
+	h.Join(bob)
+
+	h.Broadcast("hey")
+	expectMessage(t, alice, "hey")
+	expectMessage(t, bob, "hey")
+
+	h.Leave(bob)
+	h.Broadcast("bye")
+	expectMessage(t, alice, "bye")
+	expectNoMessage(t, bob)
+}
+
+func TestHubTell(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	bob := makeHubClient("Bob", "ostkreuz")
+	h.Join(alice)
+	h.Join(bob)
+
+	if h.LastTell(bob) != "" {
+		t.Error("Nobody should have told bob anything yet")
+	}
+
+	receiver, ok := h.Tell(alice, "bob", "psst")
+	if !ok || receiver != "Bob" {
+		t.Errorf("Should reach Bob case insensitive, got %q", receiver)
+	}
+	expectMessage(t, bob, "psst")
+	expectNoMessage(t, alice)
+
+	if h.LastTell(bob) != "alice" {
+		t.Errorf("Bob should reply to alice, got %q", h.LastTell(bob))
+	}
+
+	if _, ok := h.Tell(alice, "carol", "psst"); ok {
+		t.Error("Should not reach players who are not online")
+	}
+}
+
+func TestHubLeaveKeepsNewerSession(t *testing.T) {
+	h := NewHub()
+	old := makeHubClient("alice", "alex")
+	newer := makeHubClient("alice", "alex")
+	h.Join(old)
+	h.Join(newer)
+	h.Leave(old)
+
+	if _, ok := h.Tell(newer, "alice", "still here"); !ok {
+		t.Error("Leaving of an old connection should not remove the newer one")
+	}
+	expectMessage(t, newer, "still here")
+}
+
+func TestHubOnline(t *testing.T) {
+	h := NewHub()
+	bob := makeHubClient("bob", "ostkreuz")
+	alice := makeHubClient("alice", "alex")
+	alice.Player.Gamename = "Alice"
+	alice.Player.PlayerType = "hacker"
+	h.Join(bob)
+	h.Join(alice)
+
+	online := h.Online()
+	if len(online) != 2 || online[0].Nickname != "alice" || online[1].Nickname != "bob" {
+		t.Fatalf("Should list alice and bob sorted, got %v", online)
+	}
+	if online[0].Gamename != "Alice" || online[0].PlayerType != "hacker" || online[0].Room != "alex" {
+		t.Errorf("Should describe alice, got %v", online[0])
+	}
+
+	alice.Player.SetPosition("ostkreuz")
+	presence, ok := h.IsOnline("Alice")
+	if !ok || presence.Room != "ostkreuz" {
+		t.Errorf("Should find alice in ostkreuz, got %v", presence)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	h.Touch(alice)
+	alicePresence, _ := h.IsOnline("alice")
+	bobPresence, _ := h.IsOnline("bob")
+	if alicePresence.Idle() >= bobPresence.Idle() {
+		t.Error("Touch should reset the idle time")
+	}
+
+	h.Leave(bob)
+	if _, ok := h.IsOnline("bob"); ok {
+		t.Error("bob should not be online anymore")
+	}
+}
+
+func TestHubRoomExcept(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	bob := makeHubClient("bob", "alex")
+	carol := makeHubClient("carol", "ostkreuz")
+	h.Join(alice)
+	h.Join(bob)
+	h.Join(carol)
+
+	h.RoomExcept("alex", "alice", "alice leaves East")
+	expectMessage(t, bob, "alice leaves East")
+	expectNoMessage(t, alice)
+	expectNoMessage(t, carol)
+
+	present := h.InRoom("alex")
+	if len(present) != 2 || present[0].Nickname != "alice" || present[1].Nickname != "bob" {
+		t.Errorf("Should find alice and bob in alex, got %v", present)
+	}
+}
+
+func TestHubJoinTakesOver(t *testing.T) {
+	h := NewHub()
+	old := makeHubClient("alice", "alex")
+	if h.Join(old) {
+		t.Error("First join should not take over a session")
+	}
+	h.Tell(makeHubClient("bob", "alex"), "alice", "psst")
+	expectMessage(t, old, "psst")
+
+	newer := NewClient(makeHubClient("alice", "alex").Conn, old.Player)
+	if !h.Join(newer) {
+		t.Error("Second join should take over the session")
+	}
+	select {
+	case <-old.Done():
+	case <-time.After(time.Second):
+		t.Error("Old session should be closed")
+	}
+	if h.LastTell(newer) != "bob" {
+		t.Error("Session state should be kept on takeover")
+	}
+	if h.Leave(old) {
+		t.Error("Old client should not remove the taken over session")
+	}
+	if _, ok := h.IsOnline("alice"); !ok {
+		t.Error("alice should still be online")
+	}
+}
+
+func TestHubDropExpires(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	h.Join(alice)
+
+	expired := make(chan bool)
+	h.Drop(alice, 20*time.Millisecond, func() { close(expired) })
+
+	presence, ok := h.IsOnline("alice")
+	if !ok || !presence.LinkDead {
+		t.Error("alice should be link dead")
+	}
+	if _, ok := h.Tell(makeHubClient("bob", "alex"), "alice", "psst"); ok {
+		t.Error("Link dead players should not get tells")
+	}
+	h.Room("alex", "hello")
+	h.Broadcast("hey")
+	expectNoMessage(t, alice)
+
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatal("Session should expire")
+	}
+	if _, ok := h.IsOnline("alice"); ok {
+		t.Error("alice should be gone after the grace time")
+	}
+}
+
+func TestHubDropResume(t *testing.T) {
+	h := NewHub()
+	alice := makeHubClient("alice", "alex")
+	h.Join(alice)
+	h.Tell(makeHubClient("bob", "alex"), "alice", "psst")
+
+	expired := make(chan bool, 1)
+	h.Drop(alice, 50*time.Millisecond, func() { expired <- true })
+
+	again := NewClient(makeHubClient("alice", "alex").Conn, alice.Player)
+	if !h.Join(again) {
+		t.Error("Reconnect should resume the session")
+	}
+	presence, ok := h.IsOnline("alice")
+	if !ok || presence.LinkDead {
+		t.Error("alice should be connected again")
+	}
+	if h.LastTell(again) != "bob" {
+		t.Error("Resumed session should keep its state")
+	}
+
+	select {
+	case <-expired:
+		t.Error("Resumed session should not expire")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
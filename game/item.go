@@ -0,0 +1,207 @@
+package game
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Item is an object defined in a level, it starts lying in that level.
+type Item struct {
+	Key         string `xml:"key,attr"`
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+}
+
+// MatchItems finds the items the user means by input: items whose key or
+// name is input, or if there are none the items with a name starting with
+// input.
+func MatchItems(items []Item, input string) []Item {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" {
+		return nil
+	}
+	var exact, prefix []Item
+	for _, item := range items {
+		name := strings.ToLower(item.Name)
+		switch {
+		case strings.ToLower(item.Key) == input || name == input:
+			exact = append(exact, item)
+		case strings.HasPrefix(name, input):
+			prefix = append(prefix, item)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return prefix
+}
+
+// itemNames lists the names of items.
+func itemNames(items []Item) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+// GetItem looks up an item definition by its key.
+func (s *Server) GetItem(key string) (Item, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	item, ok := s.items[key]
+	return item, ok
+}
+
+// itemOrKey returns the item with the given key, unknown items are made up
+// from the key so they can still be listed and dropped.
+func (s *Server) itemOrKey(key string) Item {
+	if item, ok := s.GetItem(key); ok {
+		return item
+	}
+	return Item{Key: key, Name: key}
+}
+
+// ItemsInRoom lists the items lying in a room.
+func (s *Server) ItemsInRoom(room string) []Item {
+	s.lock.RLock()
+	keys := append([]string(nil), s.roomItems[room]...)
+	s.lock.RUnlock()
+	items := make([]Item, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, s.itemOrKey(key))
+	}
+	return items
+}
+
+// TakeItem removes an item from a room, it reports false if the item is not
+// lying there (anymore).
+func (s *Server) TakeItem(room string, key string) bool {
+	s.lock.Lock()
+	taken := false
+	keys := s.roomItems[room]
+	for i, k := range keys {
+		if k == key {
+			s.roomItems[room] = append(keys[:i:i], keys[i+1:]...)
+			taken = true
+			break
+		}
+	}
+	s.lock.Unlock()
+	if taken {
+		s.saveItems()
+	}
+	return taken
+}
+
+// PutItem drops an item into a room.
+func (s *Server) PutItem(room string, key string) {
+	s.lock.Lock()
+	s.roomItems[room] = append(s.roomItems[room], key)
+	s.lock.Unlock()
+	s.saveItems()
+}
+
+// itemState is saved next to the players, it keeps the items lying in the
+// rooms over a restart. Known are the keys of all items when it was saved,
+// known items that lie nowhere are carried and not put back into their
+// rooms.
+type itemState struct {
+	XMLName xml.Name    `xml:"items"`
+	Known   []string    `xml:"known>item"`
+	Rooms   []roomState `xml:"room"`
+}
+
+type roomState struct {
+	Key   string   `xml:"key,attr"`
+	Items []string `xml:"item"`
+}
+
+func (s *Server) itemFileName() string {
+	return s.workingdir + "/static/player/items.xml"
+}
+
+// saveItems writes the items lying in the rooms, it must not be called
+// while holding the lock.
+func (s *Server) saveItems() bool {
+	s.itemLock.Lock()
+	defer s.itemLock.Unlock()
+
+	var state itemState
+	s.lock.RLock()
+	for key := range s.items {
+		state.Known = append(state.Known, key)
+	}
+	for room, keys := range s.roomItems {
+		if len(keys) > 0 {
+			state.Rooms = append(state.Rooms, roomState{Key: room, Items: append([]string(nil), keys...)})
+		}
+	}
+	s.lock.RUnlock()
+	sort.Strings(state.Known)
+	sort.Slice(state.Rooms, func(i, j int) bool {
+		return state.Rooms[i].Key < state.Rooms[j].Key
+	})
+
+	data, err := xml.MarshalIndent(state, "", "    ")
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	fileName := s.itemFileName()
+	if err := ioutil.WriteFile(fileName+".tmp", data, 0600); err != nil {
+		log.Println(err)
+		return false
+	}
+	if err := os.Rename(fileName+".tmp", fileName); err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+// loadItems puts the items back where they were when the server stopped.
+// Without a saved state all items lie in the room of their level.
+func (s *Server) loadItems() error {
+	fileName := s.itemFileName()
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state itemState
+	if err := xml.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	known := make(map[string]bool)
+	for _, key := range state.Known {
+		known[key] = true
+	}
+	lying := make(map[string][]string)
+	for _, room := range state.Rooms {
+		lying[room.Key] = append(lying[room.Key], room.Items...)
+	}
+	s.lock.Lock()
+	s.restoreItems(s.levels, known, lying)
+	s.lock.Unlock()
+	log.Printf("Items restored from %s", fileName)
+	return nil
+}
+
+// Inventory lists the items the player carries.
+func (s *Server) Inventory(player *Player) []Item {
+	keys := player.GetInventory()
+	items := make([]Item, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, s.itemOrKey(key))
+	}
+	return items
+}
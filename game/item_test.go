@@ -0,0 +1,69 @@
+package game
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+var matchItemTests = []struct {
+	in  string
+	out string
+}{
+	{"soldering iron", "soldering iron"},
+	{"SOLDERING IRON", "soldering iron"},
+	{"iron", "soldering iron"},
+	{"sol", "soldering iron,solder"},
+	{"solder", "solder"},
+	{"s", "soldering iron,solder"},
+	{"lamp", ""},
+	{"", ""},
+}
+
+func TestMatchItems(t *testing.T) {
+	items := []Item{
+		{Key: "iron", Name: "soldering iron"},
+		{Key: "tin", Name: "solder"},
+	}
+	for _, tt := range matchItemTests {
+		if got := strings.Join(itemNames(MatchItems(items, tt.in)), ","); got != tt.out {
+			t.Errorf("items matching %q are %q, should be %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestClientItems(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	a, _ := s.GetRoom("A")
+	a.Items = []Item{{Key: "iron", Name: "soldering iron", Description: "It is still warm."}}
+	s.addLevel(a)
+
+	alice := &Player{Nickname: "alice", Position: "A"}
+	output := runTestSessionOutput(s, alice, "look\nget iron\nget iron\ninventory\nexamine iron\ne\ndrop soldering iron\n")
+
+	if !strings.Contains(output, "You see: soldering iron") {
+		t.Errorf("Items in the room should be shown, got %q", output)
+	}
+	if !strings.Contains(output, "You pick up the soldering iron.") || !strings.Contains(output, "There is no iron here.") {
+		t.Errorf("Items should be picked up once, got %q", output)
+	}
+	if !strings.Contains(output, "You carry:\n\r • soldering iron") {
+		t.Errorf("Inventory should list the item, got %q", output)
+	}
+	if !strings.Contains(output, "It is still warm.") {
+		t.Errorf("Examine should show the description, got %q", output)
+	}
+	if alice.HasItem("iron") || len(s.ItemsInRoom("A")) != 0 {
+		t.Error("The dropped item should leave the inventory")
+	}
+	if items := s.ItemsInRoom("B"); len(items) != 1 || items[0].Key != "iron" {
+		t.Errorf("The dropped item should lie in room B, got %v", items)
+	}
+
+	bob := &Player{Nickname: "bob", Position: "B"}
+	output = runTestSessionOutput(s, bob, "take sol\ninv\n")
+	if !bob.HasItem("iron") {
+		t.Errorf("Items dropped by others can be picked up, got %q", output)
+	}
+}
@@ -1,7 +1,9 @@
 package game
 
 import (
+	"encoding/xml"
 	"fmt"
+	"io"
 	"log"
 	"strings"
 	"time"
@@ -14,6 +16,7 @@ type Level struct {
 	Name        string      `xml:"name"`
 	Directions  []Direction `xml:"directions>direction"`
 	Actions     []Action    `xml:"actions>action"`
+	Items       []Item      `xml:"items>item"`
 	Messages    []Message   `xml:"messages>message"`
 	Intro       string      `xml:"intro"`
 	Asciimation Asciimation `xml:"asciimation"`
@@ -22,6 +25,7 @@ type Level struct {
 type Message struct {
 	Text         string       `xml:"text"`
 	Dependencies []Dependency `xml:"dependency"`
+	Groups
 }
 
 type Asciimation struct {
@@ -38,90 +42,266 @@ type Action struct {
 	Name         string       `xml:"name,attr"`
 	Hidden       string       `xml:"hidden,attr"`
 	Dependencies []Dependency `xml:"dependency"`
-	Answer       string       `xml:"answer"`
+	Groups
+	Answer  string   `xml:"answer"`
+	Effects []Effect `xml:"effects>effect"`
 }
 
 type Direction struct {
 	Station      string       `xml:"station"`
 	Hidden       bool         `xml:"hidden,attr"`
 	Dependencies []Dependency `xml:"dependency"`
-	Direction    string       `xml:"name"`
+	Groups
+	Direction string `xml:"name"`
 }
 
-type Dependency struct {
-	Key         string `xml:"key,attr"`
-	Type        string `xml:"type,attr"`
-	MinValue    string `xml:"minValue"`
-	MaxValue    string `xml:"maxValue"`
+// Groups combine dependencies with boolean logic. Next to the plain
+// dependencies, which all have to be met, a group can require all, any or
+// none of its dependencies. A <not> fails as soon as one member is met.
+type Groups struct {
+	All []DependencyGroup `xml:"all"`
+	Any []DependencyGroup `xml:"any"`
+	Not []DependencyGroup `xml:"not"`
+
+	// order are the element names of the dependencies and groups in the
+	// order of the level file, it is empty for groups built in code
+	order []string
+}
+
+// DependencyGroup is an <all>, <any> or <not> group, groups can be nested.
+// The messages of the group win over the messages of its members.
+type DependencyGroup struct {
+	Dependencies []Dependency `xml:"dependency"`
+	Groups
 	OkMessage   string `xml:"okMessage"`
 	FailMessage string `xml:"failMessage"`
 }
 
-func (l *Level) OnEnterRoom(s *Server, c Client) {
+// Conditions are the dependencies and groups of a message.
+func (m Message) Conditions() DependencyGroup {
+	return DependencyGroup{Dependencies: m.Dependencies, Groups: m.Groups}
+}
+
+// Conditions are the dependencies and groups of an action.
+func (a Action) Conditions() DependencyGroup {
+	return DependencyGroup{Dependencies: a.Dependencies, Groups: a.Groups}
+}
 
-	c.WriteToUser("┌────────────")
-	runeLen := len([]rune(l.Name))
-	for i := 0; i < runeLen; i++ {
-		c.WriteToUser("─")
+// Conditions are the dependencies and groups of a direction.
+func (d Direction) Conditions() DependencyGroup {
+	return DependencyGroup{Dependencies: d.Dependencies, Groups: d.Groups}
+}
+
+// UnmarshalXML decodes the message and remembers the order of its
+// conditions.
+func (m *Message) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type message Message
+	var decoded struct {
+		message
+		Inner string `xml:",innerxml"`
 	}
-	c.WriteToUser("─┐\n\r")
-	c.WriteLineToUser(fmt.Sprintf("│ You are at \033[1;30;41m%s\033[0m │", l.Name))
-	c.WriteToUser("└────────────")
-	for i := 0; i < runeLen; i++ {
-		c.WriteToUser("─")
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
 	}
-	c.WriteToUser("─┘\n\r")
+	*m = Message(decoded.message)
+	return conditionOrder(decoded.Inner, &m.Groups)
+}
 
-	if len(l.Asciimation.Frames) > 0 {
-		l.Asciimation.Play(c)
+// UnmarshalXML decodes the action and remembers the order of its
+// conditions.
+func (a *Action) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type action Action
+	var decoded struct {
+		action
+		Inner string `xml:",innerxml"`
 	}
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+	*a = Action(decoded.action)
+	return conditionOrder(decoded.Inner, &a.Groups)
+}
 
-	if l.Intro != "" {
-		c.WriteToUser(fmt.Sprintf(" > %s\n\r", l.Intro))
+// UnmarshalXML decodes the direction and remembers the order of its
+// conditions.
+func (dir *Direction) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type direction Direction
+	var decoded struct {
+		direction
+		Inner string `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
 	}
+	*dir = Direction(decoded.direction)
+	return conditionOrder(decoded.Inner, &dir.Groups)
+}
 
-	if len(l.Messages) > 0 {
-		for _, m := range l.Messages {
-			if len(m.Dependencies) > 0 {
-				ok, _ := CheckDependencies(m.Dependencies, c.Player, "")
-				if ok {
-					c.WriteToUser(fmt.Sprintf(" > %s\n\r", m.Text))
-				}
-			} else {
-				c.WriteToUser(fmt.Sprintf(" > %s\n\r", m.Text))
+// UnmarshalXML decodes the group and remembers the order of its conditions.
+func (g *DependencyGroup) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type group DependencyGroup
+	var decoded struct {
+		group
+		Inner string `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+	*g = DependencyGroup(decoded.group)
+	return conditionOrder(decoded.Inner, &g.Groups)
+}
+
+// conditionOrder stores the order of the <dependency>, <all>, <any> and
+// <not> elements of inner in groups.
+func conditionOrder(inner string, groups *Groups) error {
+	d := xml.NewDecoder(strings.NewReader(inner))
+	groups.order = nil
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "dependency", "all", "any", "not":
+			groups.order = append(groups.order, start.Name.Local)
+		}
+		if err := d.Skip(); err != nil {
+			return err
+		}
+	}
+}
+
+// condition is one dependency or nested group of a DependencyGroup, kind is
+// its element name.
+type condition struct {
+	kind       string
+	dependency Dependency
+	group      DependencyGroup
+}
+
+// conditions lists the dependencies and groups of g in the order of the
+// level file. Groups built in code list their dependencies first, then the
+// all, any and not groups.
+func (g DependencyGroup) conditions() []condition {
+	groups := map[string][]DependencyGroup{"all": g.All, "any": g.Any, "not": g.Not}
+	var list []condition
+	next := make(map[string]int)
+	add := func(kind string) bool {
+		i := next[kind]
+		if kind == "dependency" {
+			if i >= len(g.Dependencies) {
+				return false
 			}
+			list = append(list, condition{kind: kind, dependency: g.Dependencies[i]})
+		} else {
+			if i >= len(groups[kind]) {
+				return false
+			}
+			list = append(list, condition{kind: kind, group: groups[kind][i]})
+		}
+		next[kind]++
+		return true
+	}
+	for _, kind := range g.order {
+		add(kind)
+	}
+	for _, kind := range []string{"dependency", "all", "any", "not"} {
+		for add(kind) {
 		}
 	}
+	return list
 }
 
-func (a *Asciimation) Play(c Client) {
+// IsEmpty reports whether the group has no conditions at all.
+func (g DependencyGroup) IsEmpty() bool {
+	return len(g.Dependencies) == 0 && len(g.All) == 0 && len(g.Any) == 0 && len(g.Not) == 0
+}
 
-	lineCount := 0
-	frameCounter := 0
-	for _, f := range a.Frames {
-		frameCounter++
-		if lineCount == 0 {
-			lineCount = len(f.Lines)
+// Flatten lists the dependencies of the group and all nested groups.
+func (g DependencyGroup) Flatten() []Dependency {
+	var dependencies []Dependency
+	for _, c := range g.conditions() {
+		if c.kind == "dependency" {
+			dependencies = append(dependencies, c.dependency)
+		} else {
+			dependencies = append(dependencies, c.group.Flatten()...)
 		}
+	}
+	return dependencies
+}
 
-		i := 0
-		for _, l := range f.Lines {
-			i++
-			if frameCounter > 1 && i == 1 {
-				c.WriteToUser(fmt.Sprintf("\033[%dF\033[K%s\n\r", lineCount, l))
-			} else {
-				c.WriteToUser(fmt.Sprintf("\033[K%s\n\r", l))
-			}
-			if i == lineCount {
-				break
-			}
+type Dependency struct {
+	Key      string `xml:"key,attr"`
+	Type     string `xml:"type,attr"`
+	MinValue string `xml:"minValue"`
+	MaxValue string `xml:"maxValue"`
+	// Days limits time dependencies to days of the week, e.g. "mon-fri,sun"
+	Days string `xml:"days"`
+	// Expression has to be true as well, dependencies of type "expression"
+	// or without type and key only check it
+	Expression  string `xml:"expression"`
+	OkMessage   string `xml:"okMessage"`
+	FailMessage string `xml:"failMessage"`
+
+	// expression is Expression parsed by compileExpressions
+	expression *Expression
+}
+
+// kind returns the type of the dependency with the default filled in, a
+// dependency with only an <expression> is of type "expression".
+func (d Dependency) kind() string {
+	if d.Type == "" && d.Key == "" && d.Expression != "" {
+		return "expression"
+	}
+	return d.Type
+}
+
+func (l *Level) OnEnterRoom(s *Server, c *Client) {
+	// the animation of the room the player left is over
+	c.stopAnimation(true)
+
+	title := WrapText(fmt.Sprintf("You are at \033[1;30;41m%s\033[0m", l.Name), c.LineWidth()-4)
+	boxWidth := 0
+	for _, line := range title {
+		if VisibleLength(line) > boxWidth {
+			boxWidth = VisibleLength(line)
 		}
-		if frameCounter < len(a.Frames) {
-			duration := time.Duration(f.Duration) * time.Millisecond
-			time.Sleep(duration)
+	}
+	c.WriteToUser("┌" + strings.Repeat("─", boxWidth+2) + "┐\n\r")
+	for _, line := range title {
+		c.WriteToUser("│ " + line + strings.Repeat(" ", boxWidth-VisibleLength(line)) + " │\n\r")
+	}
+	c.WriteToUser("└" + strings.Repeat("─", boxWidth+2) + "┘\n\r")
+
+	describe := func() {
+		if l.Intro != "" {
+			c.WriteMessageToUser(l.Intro)
 		}
+
+		if len(l.Messages) > 0 {
+			for _, m := range l.Messages {
+				if ok, _ := CheckConditions(m.Conditions(), c.Player, "", s.Moment()); ok {
+					c.WriteMessageToUser(m.Text)
+				}
+			}
+		}
+
+		c.WriteItems(s, l.Key)
+		c.WriteOccupants(s, l.Key)
 	}
 
+	if len(l.Asciimation.Frames) > 0 && c.Player.Preference("animations") != "off" {
+		c.playAnimation(l.Asciimation, describe)
+	} else {
+		describe()
+	}
 }
 
 func (l *Level) GetRoomAction(command string) (Action, bool) {
@@ -137,17 +317,49 @@ func (l *Level) GetRoomAction(command string) (Action, bool) {
 	return Action{}, false
 }
 
+// FindDirection looks up a direction of the level by its name or shortcut.
+func (l *Level) FindDirection(input string) (Direction, bool) {
+	for _, d := range l.Directions {
+		if MatchesDirection(d.Direction, input) {
+			return d, true
+		}
+	}
+	return Direction{}, false
+}
+
+// ActionsWithPrefix lists the names of the actions starting with prefix.
+func (l *Level) ActionsWithPrefix(prefix string) []string {
+	var names []string
+	for _, a := range l.Actions {
+		if strings.HasPrefix(strings.ToLower(a.Name), strings.ToLower(prefix)) {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// DirectionTo finds the direction that leads to the station with the given
+// key.
+func (l *Level) DirectionTo(key string) (Direction, bool) {
+	for _, d := range l.Directions {
+		if d.Station == key {
+			return d, true
+		}
+	}
+	return Direction{}, false
+}
+
 func (l *Level) GetRoomActionName(action Action) string {
 	return fmt.Sprintf("%s:%s", l.Key, action.Name)
 }
 
-func (l *Level) CanDoAction(action Action, player Player) (bool, string) {
-	return CheckDependencies(action.Dependencies, player, action.Answer)
+func (l *Level) CanDoAction(action Action, player *Player, at Moment) (bool, string) {
+	return CheckConditions(action.Conditions(), player, action.Answer, at)
 }
 
-func (l *Level) CanSeeDirection(direction Direction, player Player, viewDirection string) bool {
+func (l *Level) CanSeeDirection(direction Direction, player *Player, viewDirection string) bool {
 	if viewDirection != "" {
-		return strings.ToLower(direction.Direction) == strings.ToLower(viewDirection)
+		return MatchesDirection(direction.Direction, viewDirection)
 	}
 	if player.HasAction(direction.Station) {
 		return true
@@ -158,94 +370,295 @@ func (l *Level) CanSeeDirection(direction Direction, player Player, viewDirectio
 	return true
 }
 
-func (l *Level) CanGoDirection(direction Direction, player Player) (bool, string) {
-	return CheckDependencies(direction.Dependencies, player, "")
+func (l *Level) CanGoDirection(direction Direction, player *Player, at Moment) (bool, string) {
+	return CheckConditions(direction.Conditions(), player, "", at)
 }
 
-func CheckDependencies(dependencies []Dependency, player Player, defaultAnswer string) (bool, string) {
-	if len(dependencies) == 0 {
+// CheckDependencies checks a list of dependencies that all have to be met.
+// Time dependencies are checked at the moment at.
+func CheckDependencies(dependencies []Dependency, player *Player, defaultAnswer string, at Moment) (bool, string) {
+	return CheckConditions(DependencyGroup{Dependencies: dependencies}, player, defaultAnswer, at)
+}
+
+// CheckConditions checks the dependencies and groups of conditions, all of
+// them have to be met. It returns the fail message of the first one that is
+// not met, or on success defaultAnswer if set and else the last ok message.
+func CheckConditions(conditions DependencyGroup, player *Player, defaultAnswer string, at Moment) (bool, string) {
+	ok, message := checkAll(conditions, player, at)
+	if !ok {
+		return false, message
+	}
+	if defaultAnswer != "" {
 		return true, defaultAnswer
 	}
+	return true, message
+}
 
+// checkAll requires every dependency and group of g, they are checked in
+// the order of the level file.
+func checkAll(g DependencyGroup, player *Player, at Moment) (bool, string) {
 	lastOkMessage := ""
-	for _, d := range dependencies {
-		switch d.Type {
-		case "":
-			fallthrough
-		case "action":
-			if !player.HasAction(d.Key) {
-				return false, d.FailMessage
-			}
+	for _, c := range g.conditions() {
+		ok, message := checkCondition(c, player, at)
+		if !ok {
+			return false, message
+		}
+		lastOkMessage = message
+	}
+	return true, lastOkMessage
+}
 
-			lastOkMessage = d.OkMessage
-		case "attribute":
-			playerAttribute := player.GetAttribute(d.Key)
+// checkAny requires one of the dependencies and groups of g. On success it
+// returns the ok message of the first member that is met, on failure the
+// fail message of the first member.
+func checkAny(g DependencyGroup, player *Player, at Moment) (bool, string) {
+	firstFailMessage := ""
+	for i, c := range g.conditions() {
+		ok, message := checkCondition(c, player, at)
+		if ok {
+			return true, message
+		}
+		if i == 0 {
+			firstFailMessage = message
+		}
+	}
+	return false, firstFailMessage
+}
 
-			minValue, errMin := strconv.ParseInt(d.MinValue, 10, 64)
-			if errMin==nil && d.MinValue != "" && playerAttribute < minValue {
-				return false, d.FailMessage
-			}
+// checkCondition checks one member of a group, it returns the ok message if
+// it is met and the fail message if not.
+func checkCondition(c condition, player *Player, at Moment) (bool, string) {
+	group := c.group
+	switch c.kind {
+	case "all":
+		ok, message := checkAll(group, player, at)
+		if !ok {
+			return false, orMessage(group.FailMessage, message)
+		}
+		return true, orMessage(group.OkMessage, message)
+	case "any":
+		ok, message := checkAny(group, player, at)
+		if !ok {
+			return false, orMessage(group.FailMessage, message)
+		}
+		return true, orMessage(group.OkMessage, message)
+	case "not":
+		if ok, _ := checkAny(group, player, at); ok {
+			return false, group.FailMessage
+		}
+		return true, group.OkMessage
+	}
+	if !checkDependency(c.dependency, player, at) {
+		return false, c.dependency.FailMessage
+	}
+	return true, c.dependency.OkMessage
+}
+
+func orMessage(message string, fallback string) string {
+	if message != "" {
+		return message
+	}
+	return fallback
+}
 
-			maxValue, errMax := strconv.ParseInt(d.MinValue, 10, 64)
-			if errMax==nil && d.MaxValue != "" && playerAttribute > maxValue {
-				return false, d.FailMessage
+// checkDependency checks a single dependency, unknown types are met.
+func checkDependency(d Dependency, player *Player, at Moment) bool {
+	if d.Expression != "" && !checkExpression(d, player, at) {
+		return false
+	}
+	switch d.kind() {
+	case "expression":
+		return d.Expression != ""
+	case "", "action":
+		return player.HasAction(d.Key)
+	case "item":
+		return player.HasItem(d.Key)
+	case "attribute":
+		playerAttribute := player.GetAttribute(d.Key)
+
+		minValue, errMin := strconv.ParseInt(d.MinValue, 10, 64)
+		if errMin == nil && d.MinValue != "" && playerAttribute < minValue {
+			return false
+		}
+
+		maxValue, errMax := strconv.ParseInt(d.MaxValue, 10, 64)
+		if errMax == nil && d.MaxValue != "" && playerAttribute > maxValue {
+			return false
+		}
+		return true
+	case "time":
+		return checkTime(d, at.Now)
+	case "date":
+		return checkDate(d, at.Now)
+	case "gametime":
+		if d.Key != "" && !isPhase(d.Key, Phase(at.Game)) {
+			return false
+		}
+		if d.MinValue != "" || d.MaxValue != "" || d.Days != "" {
+			return checkTime(d, at.Game)
+		}
+		return d.Key != ""
+	}
+	return true
+}
+
+// checkTime checks that the time of day of now is between MinValue and
+// MaxValue, formatted as HH:MM. Windows with MinValue after MaxValue wrap
+// around midnight, e.g. 22:00 to 04:00. Days limits the days of the week,
+// the part of a window after midnight belongs to the day it started. Without
+// times only the days are checked.
+func checkTime(d Dependency, now time.Time) bool {
+	day := now.Weekday()
+	if d.MinValue != "" || d.MaxValue != "" {
+		from, fromOk := parseClock(d.MinValue)
+		to, toOk := parseClock(d.MaxValue)
+		if !fromOk || !toOk {
+			return false
+		}
+		minutes := now.Hour()*60 + now.Minute()
+		switch {
+		case from <= to:
+			if minutes < from || minutes > to {
+				return false
 			}
+		case minutes >= from:
+		case minutes <= to:
+			day = (day + 6) % 7
+		default:
+			return false
+		}
+	} else if d.Days == "" {
+		return false
+	}
 
-			lastOkMessage = d.OkMessage
-		case "time":
-			if strings.Count(d.MinValue, ":")==1 && strings.Count(d.MaxValue, ":")==1 {
-				minParts := strings.SplitN(d.MinValue, ":", 2)
-				maxParts := strings.SplitN(d.MaxValue, ":", 2)
+	if d.Days == "" {
+		return true
+	}
+	days, err := parseWeekdays(d.Days)
+	return err == nil && days[day]
+}
 
-				nowHour := int64(time.Now().Hour());
-				nowMinute := int64(time.Now().Minute())
+// parseClock reads a time of day as H:MM or HH:MM and returns the minutes
+// since midnight.
+func parseClock(value string) (int, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hour, hourErr := strconv.Atoi(parts[0])
+	minute, minuteErr := strconv.Atoi(parts[1])
+	if hourErr != nil || minuteErr != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
 
-				minHour, minHourErr := strconv.ParseInt(minParts[0], 10, 64)
-				minMinute, minMinuteErr := strconv.ParseInt(minParts[1], 10, 64)
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
 
-				if minHourErr != nil || minMinuteErr != nil || minHour > 23 || minMinute > 59 {
-					return false, d.FailMessage
-				}
+// parseWeekdays reads a comma separated list of days and ranges of days like
+// "mon-fri,sun". Ranges can wrap around the weekend, e.g. "fri-mon".
+func parseWeekdays(value string) ([7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		var weekdays []time.Weekday
+		for _, bound := range bounds {
+			day, ok := weekdayNames[strings.ToLower(strings.TrimSpace(bound))]
+			if !ok {
+				return days, fmt.Errorf("unknown day of the week %q", strings.TrimSpace(bound))
+			}
+			weekdays = append(weekdays, day)
+		}
+		day := weekdays[0]
+		days[day] = true
+		for day != weekdays[len(weekdays)-1] {
+			day = (day + 1) % 7
+			days[day] = true
+		}
+	}
+	return days, nil
+}
 
-				if minHour > nowHour || (minHour == nowHour && minMinute > nowMinute) {
-					return false, d.FailMessage
-				}
+// checkDate checks that the day of now is between MinValue and MaxValue,
+// formatted as YYYY-MM-DD, in the time zone of now.
+func checkDate(d Dependency, now time.Time) bool {
+	from, fromError := time.ParseInLocation("2006-01-02", d.MinValue, now.Location())
+	to, toError := time.ParseInLocation("2006-01-02", d.MaxValue, now.Location())
+	if fromError != nil || toError != nil {
+		return false
+	}
+	return !now.Before(from) && now.Before(to.AddDate(0, 0, 1))
+}
 
-				maxHour, maxHourErr := strconv.ParseInt(maxParts[0], 10, 64)
-				maxMinute, maxMinuteErr := strconv.ParseInt(maxParts[1], 10, 64)
+// checkExpression evaluates the expression of d, expressions that can not
+// be parsed or evaluated are not met.
+func checkExpression(d Dependency, player *Player, at Moment) bool {
+	expression := d.expression
+	if expression == nil {
+		var err error
+		if expression, err = ParseExpression(d.Expression); err != nil {
+			log.Printf("Dependency %s: %v", d.Key, err)
+			return false
+		}
+	}
+	ok, err := expression.Eval(player, at)
+	if err != nil {
+		log.Printf("Dependency %s: %v", d.Key, err)
+		return false
+	}
+	return ok
+}
 
-				if maxHourErr != nil || maxMinuteErr != nil || maxHour > 23 || maxMinute > 59 {
-					return false, d.FailMessage
-				}
+// compileExpressions parses the expressions of all dependencies of the level
+// so syntax errors show up when the level is loaded.
+func compileExpressions(level *Level) error {
+	for i := range level.Directions {
+		d := &level.Directions[i]
+		if err := compileConditions(d.Dependencies, &d.Groups); err != nil {
+			return fmt.Errorf("direction %s: %v", d.Direction, err)
+		}
+	}
+	for i := range level.Actions {
+		a := &level.Actions[i]
+		if err := compileConditions(a.Dependencies, &a.Groups); err != nil {
+			return fmt.Errorf("action %s: %v", a.Name, err)
+		}
+	}
+	for i := range level.Messages {
+		m := &level.Messages[i]
+		if err := compileConditions(m.Dependencies, &m.Groups); err != nil {
+			return fmt.Errorf("message %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
 
-				if maxHour < nowHour || (maxHour == nowHour && maxMinute < nowMinute) {
-					return false, d.FailMessage
-				}
-				return true, d.OkMessage
-			}
-			return false, d.FailMessage
-		case "date":
-			from, fromError := time.Parse("2006-01-02 15:04:05", d.MinValue+" 00:00:00")
-			to, toError := time.Parse("2006-01-02 15:04:05", d.MaxValue+" 23:59:59")
-			now := time.Now();
-			if (fromError == nil && toError == nil) {
-				diffFrom := now.Sub(from)
-				diffTo := to.Sub(now)
-
-				if diffFrom.Seconds() < 0 {
-					return false, d.FailMessage
-				}
-				if diffTo.Seconds() < 0 {
-					return false, d.FailMessage
-				}
-				return true, d.OkMessage
-			} else {
-				return false, d.FailMessage
-			}
+func compileConditions(dependencies []Dependency, groups *Groups) error {
+	for i := range dependencies {
+		d := &dependencies[i]
+		if d.Expression == "" {
+			continue
+		}
+		expression, err := ParseExpression(d.Expression)
+		if err != nil {
+			return err
 		}
+		d.expression = expression
 	}
-	if defaultAnswer != "" {
-		lastOkMessage = defaultAnswer
+	for _, list := range [][]DependencyGroup{groups.All, groups.Any, groups.Not} {
+		for i := range list {
+			if err := compileConditions(list[i].Dependencies, &list[i].Groups); err != nil {
+				return err
+			}
+		}
 	}
-	return true, lastOkMessage
+	return nil
 }
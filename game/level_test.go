@@ -1,6 +1,7 @@
 package game
 
 import (
+	"encoding/xml"
 	"testing"
 	"time"
 )
@@ -23,12 +24,12 @@ func MakeTestDirection(name string, station string) Direction {
 }
 
 func TestLevelGoDirectionWithoutDependencies(t *testing.T) {
-	p := Player{}
+	p := &Player{}
 
 	lvl1 := MakeTestLevel("A", "default")
 	dir := MakeTestDirection("North", "b")
 
-	ok, message := lvl1.CanGoDirection(dir, p)
+	ok, message := lvl1.CanGoDirection(dir, p, testMoment)
 
 	if !ok {
 		t.Error("Not allowed to go direction")
@@ -39,7 +40,7 @@ func TestLevelGoDirectionWithoutDependencies(t *testing.T) {
 }
 
 func TestLevelGoDirectionWithMissingDependencies(t *testing.T) {
-	p := Player{}
+	p := &Player{}
 
 	lvl1 := MakeTestLevel("A", "default")
 
@@ -53,7 +54,7 @@ func TestLevelGoDirectionWithMissingDependencies(t *testing.T) {
 	dir := MakeTestDirection("North", "b")
 	dir.Dependencies = dependencies
 
-	ok, message := lvl1.CanGoDirection(dir, p)
+	ok, message := lvl1.CanGoDirection(dir, p, testMoment)
 
 	if ok {
 		t.Error("Should not be allowed to go direction")
@@ -64,7 +65,7 @@ func TestLevelGoDirectionWithMissingDependencies(t *testing.T) {
 }
 
 func TestLevelCanDoAction(t *testing.T) {
-	p := Player{}
+	p := &Player{}
 	lvl1 := MakeTestLevel("A", "default")
 
 	action := Action{
@@ -80,7 +81,7 @@ func TestLevelCanDoAction(t *testing.T) {
 	dependencies = append(dependencies, dependency)
 	action.Dependencies = dependencies
 
-	ok, message := lvl1.CanDoAction(action, p)
+	ok, message := lvl1.CanDoAction(action, p, testMoment)
 
 	if ok {
 		t.Error("Should not be allowed to do action")
@@ -91,7 +92,7 @@ func TestLevelCanDoAction(t *testing.T) {
 
 	p.LogAction("test")
 
-	ok, message = lvl1.CanDoAction(action, p)
+	ok, message = lvl1.CanDoAction(action, p, testMoment)
 
 	if !ok {
 		t.Error("Should now be allowed to do action")
@@ -102,7 +103,7 @@ func TestLevelCanDoAction(t *testing.T) {
 }
 
 func TestLevelGoDirectionWithDependencies(t *testing.T) {
-	p := Player{}
+	p := &Player{}
 
 	lvl1 := MakeTestLevel("A", "default")
 
@@ -120,7 +121,7 @@ func TestLevelGoDirectionWithDependencies(t *testing.T) {
 	dir := MakeTestDirection("North", "b")
 	dir.Dependencies = dependencies
 
-	ok, message := lvl1.CanGoDirection(dir, p)
+	ok, message := lvl1.CanGoDirection(dir, p, testMoment)
 
 	if !ok {
 		t.Error("Should not be allowed to go direction")
@@ -131,7 +132,7 @@ func TestLevelGoDirectionWithDependencies(t *testing.T) {
 }
 
 func TestCheckDependenciesAttribute(t *testing.T) {
-	p := Player{}
+	p := &Player{}
 
 	dependency := Dependency{
 		Key:"test",
@@ -144,7 +145,7 @@ func TestCheckDependenciesAttribute(t *testing.T) {
 	var dependencies []Dependency
 	dependencies = append(dependencies, dependency)
 
-	ok, msg := CheckDependencies(dependencies, p, "YES")
+	ok, msg := CheckDependencies(dependencies, p, "YES", testMoment)
 	if ok {
 		t.Error("Should get not OK")
 	}
@@ -153,7 +154,7 @@ func TestCheckDependenciesAttribute(t *testing.T) {
 	}
 
 	p.UpdateAttribute("test", 10)
-	ok, msg = CheckDependencies(dependencies, p, "YES")
+	ok, msg = CheckDependencies(dependencies, p, "YES", testMoment)
 	if !ok {
 		t.Error("Should get OK")
 	}
@@ -161,7 +162,7 @@ func TestCheckDependenciesAttribute(t *testing.T) {
 		t.Error("Should get YES as message")
 	}
 
-	ok, msg = CheckDependencies(dependencies, p, "")
+	ok, msg = CheckDependencies(dependencies, p, "", testMoment)
 	if !ok {
 		t.Error("Should get OK")
 	}
@@ -170,7 +171,7 @@ func TestCheckDependenciesAttribute(t *testing.T) {
 	}
 
 	p.UpdateAttribute("test", 10)
-	ok, msg = CheckDependencies(dependencies, p, "YES")
+	ok, msg = CheckDependencies(dependencies, p, "YES", testMoment)
 	if ok {
 		t.Error("Should get no OK")
 	}
@@ -183,44 +184,51 @@ func TestCheckDependenciesAttribute(t *testing.T) {
 var timeTests = []struct {
 	min  string
 	max  string
-	out bool
+	days string
+	out  bool
 }{
-	{"00:00", "23:59", true},
-	{"24:00", "23:59", false},
-	{"00:00", "24:59", false},
-	{"00:00", "23:60", false},
-	{"00:60", "23:59", false},
-	{"ABC", "CDE", false},
+	{"00:00", "23:59", "", true},
+	{"24:00", "23:59", "", false},
+	{"00:00", "24:59", "", false},
+	{"00:00", "23:60", "", false},
+	{"00:60", "23:59", "", false},
+	{"ABC", "CDE", "", false},
+	{"", "", "", false},
+	{"21:31", "23:59", "", false},
+	{"00:00", "21:29", "", false},
+	{"21:29", "21:31", "", true},
+	{"21:30", "21:30", "", true},
+	{"9:00", "21:30", "", true},
+	// windows wrapping around midnight
+	{"22:00", "04:00", "", false},
+	{"21:00", "04:00", "", true},
+	{"21:30", "21:29", "", true},
+	{"21:31", "21:30", "", true},
+	{"21:31", "21:29", "", false},
+	// days of the week, testNow is a friday
+	{"", "", "fri", true},
+	{"", "", "Friday", true},
+	{"", "", "mon-thu", false},
+	{"", "", "mon-fri", true},
+	{"", "", "thu-mon", true},
+	{"", "", "sat-thu", false},
+	{"", "", "sun,fri", true},
+	{"", "", "mon, wed, fri", true},
+	{"", "", "caturday", false},
+	{"21:00", "23:00", "fri", true},
+	{"21:00", "23:00", "sat", false},
+	{"21:00", "04:00", "fri", true},
 }
 
+// testNow is friday 2016-04-01 21:30, level tests check dependencies at
+// this time.
+var testNow = time.Date(2016, 4, 1, 21, 30, 0, 0, time.UTC)
+
+// testMoment is testNow in the world and in the game.
+var testMoment = Moment{Now: testNow, Game: testNow}
+
 func TestCheckDependenciesTime(t *testing.T) {
-	p := Player{}
-
-	inOneMinute := time.Now().Add(time.Duration(1) * time.Minute)
-	timeTests = append(timeTests, struct {
-		min  string
-		max  string
-		out bool
-	}{inOneMinute.Format("15:04"), "23:59", false});
-
-	beforeOneMinute := time.Now().Add(time.Duration(-1) * time.Minute)
-	timeTests = append(timeTests, struct {
-		min  string
-		max  string
-		out bool
-	}{"00:00", beforeOneMinute.Format("15:04"), false});
-
-	timeTests = append(timeTests, struct {
-		min  string
-		max  string
-		out bool
-	}{beforeOneMinute.Format("15:04"), inOneMinute.Format("15:04"), true});
-
-	timeTests = append(timeTests, struct {
-		min  string
-		max  string
-		out bool
-	}{time.Now().Format("15:04"), time.Now().Format("15:04"), true});
+	p := &Player{}
 
 	for _, tt := range timeTests {
 
@@ -229,15 +237,40 @@ func TestCheckDependenciesTime(t *testing.T) {
 			Type:"time",
 			MinValue:tt.min,
 			MaxValue:tt.max,
+			Days:tt.days,
 			OkMessage:"OK",
 			FailMessage:"FAIL",
 		}
 		var dependencies []Dependency
 		dependencies = append(dependencies, dependency)
 
-		ok, _ := CheckDependencies(dependencies, p, "YES")
+		ok, _ := CheckDependencies(dependencies, p, "YES", testMoment)
 		if ok != tt.out {
-			t.Errorf("tests for time %q - %q failed, should be %v", tt.min, tt.max, tt.out )
+			t.Errorf("tests for time %q - %q on %q failed, should be %v", tt.min, tt.max, tt.days, tt.out )
+		}
+	}
+}
+
+// after midnight an overnight window belongs to the day it started
+var overnightTests = []struct {
+	now  time.Time
+	days string
+	out  bool
+}{
+	{time.Date(2016, 4, 1, 23, 0, 0, 0, time.UTC), "fri", true},
+	{time.Date(2016, 4, 2, 3, 0, 0, 0, time.UTC), "fri", true},
+	{time.Date(2016, 4, 2, 3, 0, 0, 0, time.UTC), "sat", false},
+	{time.Date(2016, 4, 2, 23, 0, 0, 0, time.UTC), "fri", false},
+	{time.Date(2016, 4, 2, 12, 0, 0, 0, time.UTC), "fri,sat", false},
+	{time.Date(2016, 4, 4, 1, 0, 0, 0, time.UTC), "sun", true},
+}
+
+func TestCheckDependenciesOvernight(t *testing.T) {
+	p := &Player{}
+	for _, tt := range overnightTests {
+		dependencies := []Dependency{{Type: "time", MinValue: "22:00", MaxValue: "04:00", Days: tt.days}}
+		if ok, _ := CheckDependencies(dependencies, p, "", Moment{Now: tt.now}); ok != tt.out {
+			t.Errorf("22:00 - 04:00 on %s at %s should be %v", tt.days, tt.now.Format("Mon 15:04"), tt.out)
 		}
 	}
 }
@@ -250,36 +283,14 @@ var dateTests = []struct {
 	{"2014-01-01", "2020-12-31", true},
 	{"2010-01-01", "2011-01-01", false},
 	{"ABC", "CDE", false},
+	{"2016-04-02", "2020-12-31", false},
+	{"2000-01-01", "2016-03-31", false},
+	{"2016-03-31", "2016-04-02", true},
+	{"2016-04-01", "2016-04-01", true},
 }
 
 func TestCheckDependenciesDate(t *testing.T) {
-	p := Player{}
-
-	inOneDay := time.Now().Add(time.Duration(24) * time.Hour)
-	dateTests = append(dateTests, struct {
-		min  string
-		max  string
-		out bool
-	}{inOneDay.Format("2006-01-02"), "2020-12-31", false});
-
-	beforeOneDay := time.Now().Add(time.Duration(-24) * time.Hour)
-	dateTests = append(dateTests, struct {
-		min  string
-		max  string
-		out bool
-	}{"2000-01-01", beforeOneDay.Format("2006-01-02"), false});
-
-	dateTests = append(dateTests, struct {
-		min  string
-		max  string
-		out bool
-	}{beforeOneDay.Format("2006-01-02"), inOneDay.Format("2006-01-02"), true});
-
-	dateTests = append(dateTests, struct {
-		min  string
-		max  string
-		out bool
-	}{time.Now().Format("2006-01-02"), time.Now().Format("2006-01-02"), true});
+	p := &Player{}
 
 	for _, tt := range dateTests {
 
@@ -294,16 +305,39 @@ func TestCheckDependenciesDate(t *testing.T) {
 		var dependencies []Dependency
 		dependencies = append(dependencies, dependency)
 
-		ok, _ := CheckDependencies(dependencies, p, "YES")
+		ok, _ := CheckDependencies(dependencies, p, "YES", testMoment)
 		if ok != tt.out {
 			t.Errorf("tests for time %q - %q failed, should be %v", tt.min, tt.max, tt.out )
 		}
 	}
 }
 
+func TestCheckDependenciesTimeZone(t *testing.T) {
+	p := &Player{}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 23:30 UTC is already the next day in Berlin
+	now := time.Date(2016, 4, 1, 23, 30, 0, 0, time.UTC)
+
+	dependencies := []Dependency{{Type: "date", MinValue: "2016-04-02", MaxValue: "2016-04-02"}}
+	if ok, _ := CheckDependencies(dependencies, p, "", Moment{Now: now}); ok {
+		t.Error("Should still be april 1st in UTC")
+	}
+	if ok, _ := CheckDependencies(dependencies, p, "", Moment{Now: now.In(berlin)}); !ok {
+		t.Error("Should be april 2nd in Berlin")
+	}
+
+	dependencies = []Dependency{{Type: "time", MinValue: "01:00", MaxValue: "02:00", Days: "sat"}}
+	if ok, _ := CheckDependencies(dependencies, p, "", Moment{Now: now.In(berlin)}); !ok {
+		t.Error("Should be saturday 01:30 in Berlin")
+	}
+}
+
 
 func TestLevelCanSeeDirection(t *testing.T) {
-	p := Player{}
+	p := &Player{}
 
 	lvl1 := MakeTestLevel("A", "default")
 
@@ -362,4 +396,277 @@ func TestLevelGetRoomAction(t *testing.T) {
 	if testAction.Name != "testaction" {
 		t.Error("Should get false on unkwon action")
 	}
-}
\ No newline at end of file
+}
+
+func TestLevelDirectionTo(t *testing.T) {
+	lvl1 := MakeTestLevel("A", "default")
+	lvl1.Directions = append(lvl1.Directions, MakeTestDirection("b", "North"))
+
+	dir, ok := lvl1.DirectionTo("b")
+	if !ok || dir.Direction != "North" {
+		t.Error("Should find North as direction to b")
+	}
+
+	_, ok = lvl1.DirectionTo("c")
+	if ok {
+		t.Error("Should not find a direction to c")
+	}
+}
+
+func TestCheckDependenciesItem(t *testing.T) {
+	p := &Player{}
+	dependencies := []Dependency{{Key: "iron", Type: "item", OkMessage: "OK", FailMessage: "FAIL"}}
+
+	ok, message := CheckDependencies(dependencies, p, "", testMoment)
+	if ok || message != "FAIL" {
+		t.Error("Should fail without the item")
+	}
+
+	p.AddItem("iron")
+	ok, message = CheckDependencies(dependencies, p, "", testMoment)
+	if !ok || message != "OK" {
+		t.Error("Should pass when carrying the item")
+	}
+}
+
+// groupTestDependency is met when the player did action key.
+func groupTestDependency(key string) Dependency {
+	return Dependency{Key: key, OkMessage: key + " ok", FailMessage: key + " fail"}
+}
+
+var conditionTests = []struct {
+	name       string
+	conditions DependencyGroup
+	ok         bool
+	message    string
+}{
+	{"empty", DependencyGroup{}, true, ""},
+	{"plain met", DependencyGroup{
+		Dependencies: []Dependency{groupTestDependency("has")},
+	}, true, "has ok"},
+	{"plain first failing", DependencyGroup{
+		Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("missing"), groupTestDependency("gone")},
+	}, false, "missing fail"},
+	{"all met", DependencyGroup{Groups: Groups{All: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("also")},
+	}}}}, true, "also ok"},
+	{"all member message", DependencyGroup{Groups: Groups{All: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("missing")},
+	}}}}, false, "missing fail"},
+	{"all group message", DependencyGroup{Groups: Groups{All: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("missing")},
+		OkMessage:    "all ok",
+		FailMessage:  "all fail",
+	}}}}, false, "all fail"},
+	{"all group ok message", DependencyGroup{Groups: Groups{All: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has")},
+		OkMessage:    "all ok",
+	}}}}, true, "all ok"},
+	{"any first met", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("also")},
+	}}}}, true, "has ok"},
+	{"any second met", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing"), groupTestDependency("also")},
+	}}}}, true, "also ok"},
+	{"any none met", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing"), groupTestDependency("gone")},
+	}}}}, false, "missing fail"},
+	{"any group message", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing"), groupTestDependency("gone")},
+		OkMessage:    "any ok",
+		FailMessage:  "any fail",
+	}}}}, false, "any fail"},
+	{"any group ok message", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing"), groupTestDependency("also")},
+		OkMessage:    "any ok",
+	}}}}, true, "any ok"},
+	{"empty any", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		FailMessage: "any fail",
+	}}}}, false, "any fail"},
+	{"not met", DependencyGroup{Groups: Groups{Not: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing")},
+		OkMessage:    "not ok",
+		FailMessage:  "not fail",
+	}}}}, true, "not ok"},
+	{"not failing", DependencyGroup{Groups: Groups{Not: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has")},
+		OkMessage:    "not ok",
+		FailMessage:  "not fail",
+	}}}}, false, "not fail"},
+	{"not is none of", DependencyGroup{Groups: Groups{Not: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("missing")},
+	}}}}, false, ""},
+	{"not of missing", DependencyGroup{Groups: Groups{Not: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing"), groupTestDependency("gone")},
+		OkMessage:    "none ok",
+	}}}}, true, "none ok"},
+	{"not ignores member messages", DependencyGroup{Groups: Groups{Not: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("has")},
+	}}}}, false, ""},
+	{"any of all groups", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Groups: Groups{All: []DependencyGroup{
+			{Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("missing")}, FailMessage: "first fail"},
+			{Dependencies: []Dependency{groupTestDependency("has"), groupTestDependency("also")}, OkMessage: "second ok"},
+		}},
+	}}}}, true, "second ok"},
+	{"any of failing all groups", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Groups: Groups{All: []DependencyGroup{
+			{Dependencies: []Dependency{groupTestDependency("missing")}, FailMessage: "first fail"},
+			{Dependencies: []Dependency{groupTestDependency("gone")}, FailMessage: "second fail"},
+		}},
+	}}}}, false, "first fail"},
+	{"any with not", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing")},
+		Groups: Groups{Not: []DependencyGroup{
+			{Dependencies: []Dependency{groupTestDependency("gone")}, OkMessage: "not gone"},
+		}},
+	}}}}, true, "not gone"},
+	{"not of any", DependencyGroup{Groups: Groups{Not: []DependencyGroup{{
+		Groups: Groups{Any: []DependencyGroup{
+			{Dependencies: []Dependency{groupTestDependency("missing"), groupTestDependency("has")}},
+		}},
+		FailMessage: "not fail",
+	}}}}, false, "not fail"},
+	{"double not", DependencyGroup{Groups: Groups{Not: []DependencyGroup{{
+		Groups: Groups{Not: []DependencyGroup{
+			{Dependencies: []Dependency{groupTestDependency("has")}},
+		}},
+		OkMessage: "double ok",
+	}}}}, true, "double ok"},
+	{"plain before groups", DependencyGroup{
+		Dependencies: []Dependency{groupTestDependency("missing")},
+		Groups: Groups{Not: []DependencyGroup{
+			{Dependencies: []Dependency{groupTestDependency("has")}, FailMessage: "not fail"},
+		}},
+	}, false, "missing fail"},
+	{"mixed types", DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{
+			{Key: "nerd", Type: "attribute", MinValue: "50", FailMessage: "too dumb"},
+			{Key: "iron", Type: "item", OkMessage: "has iron"},
+		},
+	}}}}, true, "has iron"},
+}
+
+func TestCheckConditions(t *testing.T) {
+	p := &Player{}
+	p.LogAction("has")
+	p.LogAction("also")
+	p.AddItem("iron")
+	p.UpdateAttribute("nerd", 20)
+
+	for _, tt := range conditionTests {
+		ok, message := CheckConditions(tt.conditions, p, "", testMoment)
+		if ok != tt.ok || message != tt.message {
+			t.Errorf("%s: got %v %q, should be %v %q", tt.name, ok, message, tt.ok, tt.message)
+		}
+	}
+}
+
+func TestCheckConditionsDefaultAnswer(t *testing.T) {
+	p := &Player{}
+	p.LogAction("has")
+
+	conditions := DependencyGroup{Groups: Groups{Any: []DependencyGroup{{
+		Dependencies: []Dependency{groupTestDependency("missing"), groupTestDependency("has")},
+	}}}}
+	if ok, message := CheckConditions(conditions, p, "YES", testMoment); !ok || message != "YES" {
+		t.Errorf("got %v %q, should be true \"YES\"", ok, message)
+	}
+
+	conditions.Any[0].Dependencies = []Dependency{groupTestDependency("missing")}
+	if ok, message := CheckConditions(conditions, p, "YES", testMoment); ok || message != "missing fail" {
+		t.Errorf("got %v %q, should be false \"missing fail\"", ok, message)
+	}
+}
+
+var conditionOrderTests = []struct {
+	name    string
+	action  string
+	ok      bool
+	message string
+}{
+	{"not before failing dependency", `<action name="a">
+		<not><failMessage>not fail</failMessage><dependency key="has"/></not>
+		<dependency key="missing"><failMessage>missing fail</failMessage></dependency>
+	</action>`, false, "not fail"},
+	{"any before failing dependency", `<action name="a">
+		<any><failMessage>any fail</failMessage><dependency key="gone"/></any>
+		<dependency key="missing"><failMessage>missing fail</failMessage></dependency>
+	</action>`, false, "any fail"},
+	{"dependency before not", `<action name="a">
+		<dependency key="missing"><failMessage>missing fail</failMessage></dependency>
+		<not><failMessage>not fail</failMessage><dependency key="has"/></not>
+	</action>`, false, "missing fail"},
+	{"not before dependency in any", `<action name="a"><any>
+		<not><failMessage>not fail</failMessage><dependency key="has"/></not>
+		<dependency key="missing"><failMessage>missing fail</failMessage></dependency>
+	</any></action>`, false, "not fail"},
+	{"not before dependency in all", `<action name="a"><all>
+		<not><failMessage>not fail</failMessage><dependency key="has"/></not>
+		<dependency key="missing"><failMessage>missing fail</failMessage></dependency>
+	</all></action>`, false, "not fail"},
+	{"last ok message of a group", `<action name="a">
+		<all><okMessage>all ok</okMessage><dependency key="also"/></all>
+		<dependency key="has"><okMessage>has ok</okMessage></dependency>
+	</action>`, true, "has ok"},
+}
+
+func TestCheckConditionsInOrder(t *testing.T) {
+	p := &Player{}
+	p.LogAction("has")
+	p.LogAction("also")
+	lvl := MakeTestLevel("A", "default")
+
+	for _, tt := range conditionOrderTests {
+		var action Action
+		if err := xml.Unmarshal([]byte(tt.action), &action); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		ok, message := lvl.CanDoAction(action, p, testMoment)
+		if ok != tt.ok || message != tt.message {
+			t.Errorf("%s: got %v %q, should be %v %q", tt.name, ok, message, tt.ok, tt.message)
+		}
+	}
+}
+
+func TestLevelGroupsFromXML(t *testing.T) {
+	var direction Direction
+	err := xml.Unmarshal([]byte(`<direction>
+		<name>north</name>
+		<station>b</station>
+		<dependency key="has"/>
+		<any>
+			<failMessage>You need a key or a crowbar.</failMessage>
+			<dependency key="key" type="item"/>
+			<all>
+				<dependency key="crowbar" type="item"/>
+				<not><dependency key="tired"/></not>
+			</all>
+		</any>
+	</direction>`), &direction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Player{}
+	p.LogAction("has")
+	lvl := MakeTestLevel("A", "default")
+	if ok, message := lvl.CanGoDirection(direction, p, testMoment); ok || message != "You need a key or a crowbar." {
+		t.Errorf("got %v %q, should fail without key or crowbar", ok, message)
+	}
+
+	p.AddItem("crowbar")
+	if ok, _ := lvl.CanGoDirection(direction, p, testMoment); !ok {
+		t.Error("Should pass with a crowbar")
+	}
+
+	p.LogAction("tired")
+	if ok, _ := lvl.CanGoDirection(direction, p, testMoment); ok {
+		t.Error("Should fail when tired")
+	}
+
+	if got := len(direction.Conditions().Flatten()); got != 4 {
+		t.Errorf("Flatten returned %d dependencies, should be 4", got)
+	}
+}
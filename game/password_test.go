@@ -0,0 +1,63 @@
+package game
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// lowerPasswordCost makes hashing passwords fast for the rest of the test.
+func lowerPasswordCost(t *testing.T) {
+	iterations := passwordIterations
+	passwordIterations = 1000
+	t.Cleanup(func() { passwordIterations = iterations })
+}
+
+func TestPbkdf2(t *testing.T) {
+	// test vector from RFC 7914, section 11
+	key := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(key) != expected {
+		t.Errorf("pbkdf2 got %x, should be %s", key, expected)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !CheckPassword(hash, "secret") {
+		t.Error("Password should match its hash")
+	}
+	if CheckPassword(hash, "Secret") {
+		t.Error("Wrong password should not match")
+	}
+
+	other, _ := HashPassword("secret")
+	if other == hash {
+		t.Error("Hashes of the same password should be salted differently")
+	}
+
+	if _, err := HashPassword(""); err == nil {
+		t.Error("Empty password should not be hashed")
+	}
+}
+
+var brokenHashTests = []string{
+	"",
+	"secret",
+	"md5$1$c2FsdA$c2FsdA",
+	"pbkdf2-sha256$abc$c2FsdA$c2FsdA",
+	"pbkdf2-sha256$1$!!!$c2FsdA",
+	"pbkdf2-sha256$1$c2FsdA$",
+}
+
+func TestCheckPasswordBrokenHash(t *testing.T) {
+	for _, hash := range brokenHashTests {
+		if CheckPassword(hash, "secret") {
+			t.Errorf("broken hash %q should never match", hash)
+		}
+	}
+}
@@ -3,31 +3,78 @@ package game
 import (
 	"encoding/xml"
 	"strings"
+	"sync"
 )
 
+// Player is shared by the server and the session of the player, only one
+// instance exists per character. Fields are written under lock, methods
+// lock on their own.
 type Player struct {
-	XMLName    xml.Name    `xml:"player"`
-	Nickname   string      `xml:"nickname,attr"`
-	Gamename   string      `xml:"name"`
-	Position   string      `xml:"position,attr"`
-	PlayerType string      `xml:"type"`
-	Ch         chan string `xml:"-"`
-	ActionLog  []string    `xml:"actions>action"`
-	Attributes []Attribute `xml:"attributes>attribute"`
+	lock        sync.RWMutex
+	XMLName     xml.Name     `xml:"player"`
+	Nickname    string       `xml:"nickname,attr"`
+	Gamename    string       `xml:"name"`
+	Position    string       `xml:"position,attr"`
+	PlayerType  string       `xml:"type"`
+	Password    string       `xml:"password,omitempty"`
+	Ch          chan string  `xml:"-"`
+	ActionLog   []string     `xml:"actions>action"`
+	Attributes  []Attribute  `xml:"attributes>attribute"`
+	Inventory   []string     `xml:"inventory>item"`
+	Preferences []Preference `xml:"preferences>preference"`
+}
+
+// Preference is a setting the player chose with the set command.
+type Preference struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
 }
 
 type Attribute struct {
-	Name   string   `xml:"name,attr"`
-	Value  int64    `xml:"value"`
+	Name  string `xml:"name,attr"`
+	Value int64  `xml:"value"`
+}
+
+func (p *Player) GetPosition() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.Position
+}
+
+func (p *Player) SetPosition(key string) {
+	p.lock.Lock()
+	p.Position = key
+	p.lock.Unlock()
 }
 
 func (p *Player) LogAction(action string) {
-	if !p.HasAction(action) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.hasAction(action) {
 		p.ActionLog = append(p.ActionLog, strings.ToLower(action))
 	}
 }
 
+// RevokeAction removes an action from the log, as if the player never did
+// it.
+func (p *Player) RevokeAction(action string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, a := range p.ActionLog {
+		if strings.ToLower(a) == strings.ToLower(action) {
+			p.ActionLog = append(p.ActionLog[:i:i], p.ActionLog[i+1:]...)
+			return
+		}
+	}
+}
+
 func (p *Player) HasAction(action string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.hasAction(action)
+}
+
+func (p *Player) hasAction(action string) bool {
 	for _, a := range p.ActionLog {
 		if strings.ToLower(a) == strings.ToLower(action) {
 			return true
@@ -37,6 +84,8 @@ func (p *Player) HasAction(action string) bool {
 }
 
 func (p *Player) GetAttribute(name string) int64 {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 	for _, a := range p.Attributes {
 		if strings.ToLower(a.Name) == strings.ToLower(name) {
 			return a.Value
@@ -46,6 +95,8 @@ func (p *Player) GetAttribute(name string) int64 {
 }
 
 func (p *Player) UpdateAttribute(name string, update int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	for i := range p.Attributes {
 		if strings.ToLower(p.Attributes[i].Name) == strings.ToLower(name) {
 			p.Attributes[i].Value = p.Attributes[i].Value + update
@@ -57,7 +108,124 @@ func (p *Player) UpdateAttribute(name string, update int64) {
 	}
 
 	p.Attributes = append(p.Attributes, Attribute{
-		Name: name,
+		Name:  name,
 		Value: update,
 	})
 }
+
+// SetAttribute sets an attribute to value, like UpdateAttribute it does not
+// go below 0.
+func (p *Player) SetAttribute(name string, value int64) {
+	if value < 0 {
+		value = 0
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i := range p.Attributes {
+		if strings.ToLower(p.Attributes[i].Name) == strings.ToLower(name) {
+			p.Attributes[i].Value = value
+			return
+		}
+	}
+	p.Attributes = append(p.Attributes, Attribute{
+		Name:  name,
+		Value: value,
+	})
+}
+
+// GetInventory returns the keys of the items the player carries.
+func (p *Player) GetInventory() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return append([]string(nil), p.Inventory...)
+}
+
+func (p *Player) HasItem(key string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	for _, k := range p.Inventory {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Player) AddItem(key string) {
+	p.lock.Lock()
+	p.Inventory = append(p.Inventory, key)
+	p.lock.Unlock()
+}
+
+// RemoveItem takes one item out of the inventory, it reports false if the
+// player does not carry it.
+func (p *Player) RemoveItem(key string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, k := range p.Inventory {
+		if strings.EqualFold(k, key) {
+			p.Inventory = append(p.Inventory[:i:i], p.Inventory[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Preference returns the value the player chose for a preference or its
+// default.
+func (p *Player) Preference(name string) string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	for _, pref := range p.Preferences {
+		if pref.Name == name {
+			return pref.Value
+		}
+	}
+	if info, ok := findPreference(name); ok {
+		return info.Values[0]
+	}
+	return ""
+}
+
+func (p *Player) SetPreference(name string, value string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, pref := range p.Preferences {
+		if pref.Name == name {
+			p.Preferences[i].Value = value
+			return
+		}
+	}
+	p.Preferences = append(p.Preferences, Preference{Name: name, Value: value})
+}
+
+func (p *Player) HasPassword() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.Password != ""
+}
+
+func (p *Player) SetPassword(password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	p.Password = hash
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *Player) CheckPassword(password string) bool {
+	p.lock.RLock()
+	hash := p.Password
+	p.lock.RUnlock()
+	return CheckPassword(hash, password)
+}
+
+// marshal encodes the player for its player file.
+func (p *Player) marshal() ([]byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return xml.MarshalIndent(p, "", "    ")
+}
@@ -1,6 +1,7 @@
 package game
 
 import (
+	"encoding/xml"
 	"testing"
 )
 
@@ -66,4 +67,30 @@ func TestActions(t *testing.T) {
 	if player.HasAction("foo") {
 		t.Error("Player player should not have foo action")
 	}
-}
\ No newline at end of file
+}
+func TestPlayerInventory(t *testing.T) {
+	player := Player{}
+	player.AddItem("iron")
+	player.AddItem("iron")
+	player.AddItem("tin")
+
+	if !player.HasItem("IRON") || player.HasItem("lamp") {
+		t.Error("Player should carry iron but no lamp")
+	}
+	if !player.RemoveItem("Iron") || !player.HasItem("iron") {
+		t.Error("Removing one of two irons should keep the other")
+	}
+	if player.RemoveItem("lamp") {
+		t.Error("Items the player does not carry can not be removed")
+	}
+	if len(player.GetInventory()) != 2 {
+		t.Errorf("Player should carry two items, got %v", player.GetInventory())
+	}
+
+	data, _ := player.marshal()
+	loaded := Player{}
+	xml.Unmarshal(data, &loaded)
+	if len(loaded.Inventory) != 2 || !loaded.HasItem("tin") {
+		t.Errorf("Inventory should be saved, got %s", data)
+	}
+}
@@ -0,0 +1,83 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PreferenceInfo describes a preference players can set, the first value is
+// the default.
+type PreferenceInfo struct {
+	Name   string
+	Help   string
+	Values []string
+}
+
+// preferences are the preferences the set command knows.
+var preferences = []PreferenceInfo{
+	{Name: "animations", Help: "play the animations of rooms", Values: []string{"on", "off"}},
+}
+
+func findPreference(name string) (PreferenceInfo, bool) {
+	for _, info := range preferences {
+		if strings.EqualFold(info.Name, name) {
+			return info, true
+		}
+	}
+	return PreferenceInfo{}, false
+}
+
+func (info PreferenceInfo) valid(value string) bool {
+	for _, v := range info.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// valueList formats the values as "on or off".
+func (info PreferenceInfo) valueList() string {
+	if len(info.Values) == 1 {
+		return info.Values[0]
+	}
+	return strings.Join(info.Values[:len(info.Values)-1], ", ") + " or " + info.Values[len(info.Values)-1]
+}
+
+func setCommand(c *Client, server *Server, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		c.WriteLineToUser("Your preferences:")
+		for _, info := range preferences {
+			c.WriteLineToUser(fmt.Sprintf(" * %-12s %-5s %s (%s)", info.Name, c.Player.Preference(info.Name), info.Help, info.valueList()))
+		}
+		return
+	}
+
+	info, ok := findPreference(fields[0])
+	if !ok {
+		var names []string
+		for _, info := range preferences {
+			names = append(names, info.Name)
+		}
+		message := fmt.Sprintf("Unknown preference %s.", fields[0])
+		if question := didYouMean(Suggest(fields[0], names)); question != "" {
+			message += " " + question
+		}
+		c.WriteLineToUser(message)
+		return
+	}
+	if len(fields) == 1 {
+		c.WriteLineToUser(fmt.Sprintf("%s is %s.", info.Name, c.Player.Preference(info.Name)))
+		return
+	}
+
+	value := strings.ToLower(fields[1])
+	if !info.valid(value) {
+		c.WriteLineToUser(fmt.Sprintf("%s can be %s.", info.Name, info.valueList()))
+		return
+	}
+	c.Player.SetPreference(info.Name, value)
+	server.SavePlayer(c.Player)
+	c.WriteLineToUser(fmt.Sprintf("%s is now %s.", info.Name, value))
+}
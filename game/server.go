@@ -1,38 +1,160 @@
 package game
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
+	"time"
 )
 
+// after MaxLoginFailures wrong passwords a nickname is locked for
+// LoginLockout
+const (
+	MaxLoginFailures = 3
+	LoginLockout     = 5 * time.Minute
+)
+
+// Server is safe for concurrent use, players, levels and the default level
+// are guarded by lock.
 type Server struct {
-	players      map[string]Player
-	levels       map[string]Level
+	lock       sync.RWMutex
+	saveLock   sync.Mutex
+	reloadLock sync.Mutex
+	players    map[string]*Player
+	levels     map[string]Level
+	// items are the item definitions of all levels, roomItems the keys of
+	// the items lying in each room
+	items     map[string]Item
+	roomItems map[string][]string
+	// itemLock orders the saves of the items lying in the rooms
+	itemLock     sync.Mutex
 	workingdir   string
 	DefaultLevel Level
 	Config       ServerConfig
+	Hub          *Hub
+	Commands     *Commands
+	// Clock tells the time for time and date dependencies
+	Clock func() time.Time
+
+	loginLock     sync.Mutex
+	loginFailures map[string]*loginFailure
+
+	// connections accepted by Serve, closed on Shutdown
+	serveLock    sync.Mutex
+	listeners    []net.Listener
+	conns        map[net.Conn]struct{}
+	handlers     sync.WaitGroup
+	shuttingDown bool
+}
+
+// ErrServerClosed is returned by Serve after Shutdown was called.
+var ErrServerClosed = errors.New("game: server closed")
+
+type loginFailure struct {
+	count int
+	until time.Time
 }
 
+// DefaultWidth is used for word wrapping when neither the client reports
+// its terminal width nor the config sets one.
+const DefaultWidth = 80
+
 type ServerConfig struct {
 	Name      string `xml:"name"`
 	Interface string `xml:"interface"`
 	Motd      string `xml:"motd"`
+	Width     int    `xml:"width"`
+	// WhoShowsRooms adds the room of every player to the who list
+	WhoShowsRooms bool `xml:"whoShowsRooms"`
+	// ReconnectGrace is the time in seconds a session is kept after the
+	// connection was lost, 0 disables reconnecting
+	ReconnectGrace int `xml:"reconnectGrace"`
+	// ShutdownCountdown is the time in seconds players are warned before
+	// the server shuts down
+	ShutdownCountdown int `xml:"shutdownCountdown"`
+	// LoginTimeout is the time in seconds a connection has to log in
+	LoginTimeout int `xml:"loginTimeout"`
+	// AfkTime is the idle time in seconds after which a player is shown
+	// as away from keyboard
+	AfkTime int `xml:"afkTime"`
+	// IdleTimeout is the idle time in seconds after which a player is
+	// disconnected, IdleWarning seconds before that the player is warned.
+	// 0 disables the timeouts.
+	IdleTimeout int `xml:"idleTimeout"`
+	IdleWarning int `xml:"idleWarning"`
+	// Admins are the nicknames of the players with admin permission
+	Admins []string `xml:"admins>admin"`
+	// TimeZone is the IANA time zone of the world, e.g. Europe/Berlin.
+	// Time and date dependencies use it, the default is the local time
+	// zone of the host.
+	TimeZone string `xml:"timeZone"`
+
+	// GameTimeRatio is how many times faster the in-game clock runs than
+	// the world clock, e.g. 12 for a day every two hours
+	GameTimeRatio float64 `xml:"gameTimeRatio"`
+
+	// location is TimeZone loaded by readConfig
+	location *time.Location
+}
+
+// idleWarning is the time in seconds between the idle warning and the
+// disconnect, 0 if no warning is sent.
+func (c ServerConfig) idleWarning() int {
+	if c.IdleWarning <= 0 || c.IdleWarning >= c.IdleTimeout {
+		return 0
+	}
+	return c.IdleWarning
+}
+
+// Location returns the time zone of the world.
+func (c ServerConfig) Location() *time.Location {
+	if c.location != nil {
+		return c.location
+	}
+	if location, err := time.LoadLocation(c.TimeZone); err == nil && c.TimeZone != "" {
+		return location
+	}
+	return time.Local
+}
+
+// IsAFK reports whether an online player is idle longer than AfkTime.
+func (c ServerConfig) IsAFK(p Presence) bool {
+	return c.AfkTime > 0 && p.Idle() >= time.Duration(c.AfkTime)*time.Second
 }
 
 func (s *Server) HasDefaultLevel() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	return s.DefaultLevel.Key != ""
 }
 
 func NewServer(serverdir string) *Server {
 	server := &Server{
-		players:    make(map[string]Player),
+		players:    make(map[string]*Player),
 		levels:     make(map[string]Level),
+		items:      make(map[string]Item),
+		roomItems:  make(map[string][]string),
 		workingdir: serverdir,
+		Hub:        NewHub(),
+		Commands:   NewCommands(),
+		Clock:      time.Now,
+
+		loginFailures: make(map[string]*loginFailure),
+		conns:         make(map[net.Conn]struct{}),
+	}
+
+	for _, cmd := range builtinCommands() {
+		if err := server.Commands.Register(cmd); err != nil {
+			panic(err)
+		}
 	}
 
 	server.LoadConfig()
@@ -42,24 +164,52 @@ func NewServer(serverdir string) *Server {
 
 func (s *Server) LoadConfig() error {
 	log.Println("Loading config ...")
+	config, err := s.readConfig()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.Config = config
+	s.lock.Unlock()
+	log.Println(" config loaded")
+	return nil
+}
+
+func (s *Server) readConfig() (ServerConfig, error) {
+	config := ServerConfig{}
 	configFileName := s.workingdir + "/static/server.xml"
 	fileContent, fileIoErr := ioutil.ReadFile(configFileName)
 	if fileIoErr != nil {
 		log.Printf("\n")
 		log.Printf("File %s could not be loaded\n", configFileName)
 		log.Printf("%v", fileIoErr)
-		return fileIoErr
+		return config, fileIoErr
 	}
-	config := ServerConfig{}
 	if xmlerr := xml.Unmarshal(fileContent, &config); xmlerr != nil {
 		log.Printf("\n")
-		log.Printf("File %s could not be Unmarshaled\n", configFileName, xmlerr)
+		log.Printf("File %s could not be Unmarshaled\n", configFileName)
 		log.Printf("%v", xmlerr)
-		return xmlerr
+		return config, xmlerr
 	}
-	s.Config = config
-	log.Println(" config loaded")
-	return nil
+	if config.Width <= 0 {
+		config.Width = DefaultWidth
+	}
+	if config.TimeZone != "" {
+		location, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			log.Printf("Unknown time zone %q in %s\n", config.TimeZone, configFileName)
+			return config, err
+		}
+		config.location = location
+	}
+	return config, nil
+}
+
+// GetConfig returns the current config, it may change with Reload.
+func (s *Server) GetConfig() ServerConfig {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.Config
 }
 
 func (s *Server) LoadLevels() error {
@@ -68,26 +218,111 @@ func (s *Server) LoadLevels() error {
 		if info.IsDir() {
 			return nil
 		}
-		fileContent, fileIoErr := ioutil.ReadFile(path)
-		if fileIoErr != nil {
-			log.Printf("\n")
-			log.Printf("File %s could not be loaded\n", path)
-			log.Printf("%v", fileIoErr)
-			return fileIoErr
-		}
-		level := Level{}
-		if xmlerr := xml.Unmarshal(fileContent, &level); xmlerr != nil {
-			log.Printf("\n")
-			log.Printf("File %s could not be Unmarshaled\n", path, xmlerr)
-			log.Printf("%v", xmlerr)
-			return xmlerr
+		level, err := readLevel(path)
+		if err != nil {
+			return err
 		}
 		log.Printf(" loaded: %s\n", info.Name())
 		s.addLevel(level)
 		return nil
 	}
 
-	return filepath.Walk(s.workingdir+"/static/levels/", levelWalker)
+	if err := filepath.Walk(s.levelDir(), levelWalker); err != nil {
+		return err
+	}
+	return s.loadItems()
+}
+
+// Reload reads the config and the levels again and swaps them in at once.
+// The levels are validated first, nothing changes if there are errors,
+// warnings are logged. Players whose room is gone are moved to the default level.
+func (s *Server) Reload() error {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	log.Println("Reloading config and levels ...")
+
+	config, err := s.readConfig()
+	if err != nil {
+		return err
+	}
+	files, problems, err := loadLevelFiles(s.levelDir())
+	if err != nil {
+		return err
+	}
+	problems = append(problems, validateLevels(files)...)
+	if errors := Errors(problems); len(errors) > 0 {
+		return &ValidationError{Problems: errors}
+	}
+	for _, problem := range problems {
+		log.Println(problem)
+	}
+
+	levels := make(map[string]Level)
+	var defaultLevel Level
+	for _, f := range files {
+		levels[f.level.Key] = f.level
+		if f.level.Tag == "default" {
+			defaultLevel = f.level
+		}
+	}
+
+	s.lock.Lock()
+	if config.Interface != s.Config.Interface {
+		log.Printf("The interface changes to %s after a restart", config.Interface)
+	}
+	s.Config = config
+	s.levels = levels
+	s.DefaultLevel = defaultLevel
+	known := make(map[string]bool)
+	for key := range s.items {
+		known[key] = true
+	}
+	s.restoreItems(levels, known, s.roomItems)
+	players := make([]*Player, 0, len(s.players))
+	for _, player := range s.players {
+		players = append(players, player)
+	}
+	s.lock.Unlock()
+	s.saveItems()
+
+	for _, player := range players {
+		if _, ok := levels[player.GetPosition()]; ok {
+			continue
+		}
+		log.Printf("Room %s of %s is gone, moving to %s", player.GetPosition(), player.Nickname, defaultLevel.Key)
+		player.SetPosition(defaultLevel.Key)
+		s.SavePlayer(player)
+		s.Hub.Send(player.Nickname, fmt.Sprintf("The room you were in is gone, you are at %s now.", defaultLevel.Name))
+	}
+	log.Printf(" reloaded %d levels", len(levels))
+	return nil
+}
+
+func (s *Server) levelDir() string {
+	return s.workingdir + "/static/levels/"
+}
+
+// readLevel loads one level file.
+func readLevel(path string) (Level, error) {
+	level := Level{}
+	fileContent, fileIoErr := ioutil.ReadFile(path)
+	if fileIoErr != nil {
+		log.Printf("\n")
+		log.Printf("File %s could not be loaded\n", path)
+		log.Printf("%v", fileIoErr)
+		return level, fileIoErr
+	}
+	if xmlerr := xml.Unmarshal(fileContent, &level); xmlerr != nil {
+		log.Printf("\n")
+		log.Printf("File %s could not be Unmarshaled\n", path)
+		log.Printf("%v", xmlerr)
+		return level, xmlerr
+	}
+	if err := compileExpressions(&level); err != nil {
+		log.Printf("File %s has an invalid expression: %v\n", path, err)
+		return level, err
+	}
+	return level, nil
 }
 
 func (s *Server) getPlayerFileName(playerName string) (bool, string) {
@@ -108,12 +343,17 @@ func (s *Server) IsValidUsername(playerName string) bool {
 	return true
 }
 
+// LoadPlayer reads the player file unless the player is loaded already,
+// the loaded instance is the live state and must not be replaced.
 func (s *Server) LoadPlayer(playerName string) bool {
 	ok, playerFileName := s.getPlayerFileName(playerName)
 	if !ok {
 		return false
 	}
-	log.Println("Loading player %s", playerFileName)
+	if _, loaded := s.GetPlayerByNick(playerName); loaded {
+		return true
+	}
+	log.Printf("Loading player %s", playerFileName)
 
 	fileContent, fileIoErr := ioutil.ReadFile(playerFileName)
 	if fileIoErr != nil {
@@ -124,86 +364,397 @@ func (s *Server) LoadPlayer(playerName string) bool {
 		return false
 	}
 
-	player := Player{}
-	if xmlerr := xml.Unmarshal(fileContent, &player); xmlerr != nil {
+	player := &Player{}
+	if xmlerr := xml.Unmarshal(fileContent, player); xmlerr != nil {
 		log.Printf("\n")
-		log.Printf("File %s could not be Unmarshaled\n", playerFileName, xmlerr)
+		log.Printf("File %s could not be Unmarshaled\n", playerFileName)
 		log.Printf("%v", xmlerr)
 		//return xmlerr
 		return false
 	}
 	log.Printf(" loaded: %s", player.Gamename)
-	s.addPlayer(player)
+	s.lock.Lock()
+	if _, loaded := s.players[player.Nickname]; !loaded {
+		s.players[player.Nickname] = player
+	}
+	s.lock.Unlock()
 
 	return true
 }
 
 func (s *Server) addLevel(level Level) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	if level.Tag == "default" {
 		log.Printf("default level loaded: %s\n", level.Key)
 		s.DefaultLevel = level
 	}
 	s.levels[level.Key] = level
+	s.placeItems(level)
 	return nil
 }
 
-func (s *Server) addPlayer(player Player) error {
+// placeItems registers the items of level and puts them into its room. The
+// caller has to hold the lock.
+func (s *Server) placeItems(level Level) {
+	s.roomItems[level.Key] = nil
+	for _, item := range level.Items {
+		s.items[item.Key] = item
+		s.roomItems[level.Key] = append(s.roomItems[level.Key], item.Key)
+	}
+}
+
+// restoreItems registers the items of levels. Items that were known before
+// stay where they lie or with the players who carry them, so nothing
+// reappears or doubles. New items and items of rooms that are gone are put
+// into the room of their level. The caller has to hold the lock.
+func (s *Server) restoreItems(levels map[string]Level, known map[string]bool, lying map[string][]string) {
+	s.items = make(map[string]Item)
+	s.roomItems = make(map[string][]string)
+	for _, level := range levels {
+		for _, item := range level.Items {
+			s.items[item.Key] = item
+		}
+	}
+
+	homeless := make(map[string]bool)
+	for room, keys := range lying {
+		for _, key := range keys {
+			if _, ok := s.items[key]; !ok {
+				continue
+			}
+			if _, ok := levels[room]; ok {
+				s.roomItems[room] = append(s.roomItems[room], key)
+			} else {
+				homeless[key] = true
+			}
+		}
+	}
+	for _, level := range levels {
+		for _, item := range level.Items {
+			if !known[item.Key] || homeless[item.Key] {
+				s.roomItems[level.Key] = append(s.roomItems[level.Key], item.Key)
+			}
+		}
+	}
+}
+
+func (s *Server) addPlayer(player *Player) error {
+	s.lock.Lock()
 	s.players[player.Nickname] = player
+	s.lock.Unlock()
 	return nil
 }
 
-func (s *Server) GetPlayerByNick(nickname string) (Player, bool) {
+// GetPlayerByNick returns the shared instance of a loaded player.
+func (s *Server) GetPlayerByNick(nickname string) (*Player, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	player, ok := s.players[nickname]
 	return player, ok
 }
 
 func (s *Server) GetRoom(key string) (Level, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	level, ok := s.levels[key]
 	return level, ok
 }
 
-func (s *Server) GetName() string {
-	return s.Config.Name
+// Online lists all players that are currently connected.
+func (s *Server) Online() []Presence {
+	return s.Hub.Online()
 }
 
-func (s *Server) CreatePlayer(nick string, name string, playerType string) {
-	ok, playerFileName := s.getPlayerFileName(nick)
-	if !ok {
+// IsOnline reports whether the player with the given nickname is connected.
+func (s *Server) IsOnline(nickname string) (Presence, bool) {
+	return s.Hub.IsOnline(nickname)
+}
+
+// StartSession registers the client of a logged in player. It reports
+// whether an existing session of the player was resumed or taken over.
+func (s *Server) StartSession(c *Client) bool {
+	return s.Hub.Join(c)
+}
+
+// EndSession is called when the connection of a client is gone. Players who
+// quit leave right away, lost connections keep their session for the
+// reconnect grace time.
+func (s *Server) EndSession(c *Client) {
+	left := func() {
+		s.SavePlayer(c.Player)
+		s.Hub.Broadcast(fmt.Sprintf("User %s left the chat room.", c.Player.Nickname))
+	}
+	if c.HasQuit() || s.GetConfig().ReconnectGrace <= 0 || s.isShuttingDown() {
+		if s.Hub.Leave(c) {
+			left()
+		}
 		return
 	}
-	if _, err := os.Stat(playerFileName); err == nil {
-		s.LoadPlayer(nick)
-		fmt.Printf("Player %s does already exists", nick)
+	s.Hub.Drop(c, time.Duration(s.GetConfig().ReconnectGrace)*time.Second, left)
+}
+
+// Serve accepts connections on ln and runs handle for each of them in its
+// own goroutine until Shutdown is called.
+func (s *Server) Serve(ln net.Listener, handle func(net.Conn)) error {
+	s.serveLock.Lock()
+	if s.shuttingDown {
+		s.serveLock.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, ln)
+	s.serveLock.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isShuttingDown() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				log.Println(err)
+				continue
+			}
+			return err
+		}
+
+		s.serveLock.Lock()
+		if s.shuttingDown {
+			s.serveLock.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.handlers.Add(1)
+		s.serveLock.Unlock()
+
+		go func() {
+			defer func() {
+				s.serveLock.Lock()
+				delete(s.conns, conn)
+				s.serveLock.Unlock()
+				s.handlers.Done()
+			}()
+			handle(conn)
+		}()
+	}
+}
+
+func (s *Server) isShuttingDown() bool {
+	s.serveLock.Lock()
+	defer s.serveLock.Unlock()
+	return s.shuttingDown
+}
+
+// Shutdown stops accepting connections, warns the players during the
+// configured countdown, closes every connection and saves all players. It
+// waits for the connection handlers to return unless ctx is done first, the
+// countdown is cut short then as well.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.serveLock.Lock()
+	if s.shuttingDown {
+		s.serveLock.Unlock()
+		return ErrServerClosed
+	}
+	s.shuttingDown = true
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	s.serveLock.Unlock()
+	log.Println("Shutting down ...")
+
+	s.countdown(ctx, time.Duration(s.GetConfig().ShutdownCountdown)*time.Second)
+
+	s.Hub.Disconnect("The server is shutting down, good bye.")
+	s.serveLock.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.serveLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.saveAll()
+	log.Println(" shut down")
+	return err
+}
+
+// countdown broadcasts shutdown warnings until d is over or ctx is done.
+func (s *Server) countdown(ctx context.Context, d time.Duration) {
+	if d <= 0 {
 		return
 	}
-	player := Player{
+	end := time.Now().Add(d)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		left := time.Until(end).Round(time.Second)
+		if left <= 0 {
+			return
+		}
+		seconds := int(left / time.Second)
+		if seconds == int(d/time.Second) || seconds%10 == 0 || seconds <= 5 {
+			s.Hub.Broadcast(fmt.Sprintf("The server shuts down in %d seconds.", seconds))
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// saveAll saves every loaded player.
+func (s *Server) saveAll() {
+	s.lock.RLock()
+	players := make([]*Player, 0, len(s.players))
+	for _, player := range s.players {
+		players = append(players, player)
+	}
+	s.lock.RUnlock()
+	for _, player := range players {
+		s.SavePlayer(player)
+	}
+}
+
+// PermissionOf returns the permission level of a player.
+func (s *Server) PermissionOf(player *Player) Permission {
+	for _, admin := range s.GetConfig().Admins {
+		if admin == player.Nickname {
+			return PermissionAdmin
+		}
+	}
+	return PermissionPlayer
+}
+
+func (s *Server) GetName() string {
+	return s.GetConfig().Name
+}
+
+func (s *Server) CreatePlayer(nick string, name string, playerType string, password string) bool {
+	ok, playerFileName := s.getPlayerFileName(nick)
+	if !ok {
+		return false
+	}
+	player := &Player{
 		Gamename:   name,
 		Nickname:   nick,
 		PlayerType: playerType,
-		Position:   s.DefaultLevel.Key,
 	}
-	s.addPlayer(player)
+	if err := player.SetPassword(password); err != nil {
+		log.Println(err)
+		return false
+	}
+
+	// checking, adding and saving under one lock makes sure two
+	// connections can not create the same player at once
+	s.lock.Lock()
+	_, loaded := s.players[nick]
+	if _, err := os.Stat(playerFileName); err == nil || loaded {
+		s.lock.Unlock()
+		s.LoadPlayer(nick)
+		fmt.Printf("Player %s does already exists", nick)
+		return false
+	}
+	player.Position = s.DefaultLevel.Key
+	s.players[nick] = player
+	defer s.lock.Unlock()
+
+	return s.SavePlayer(player)
+}
+
+// SetPlayerPassword sets a new password for an already loaded player and
+// saves it.
+func (s *Server) SetPlayerPassword(nick string, password string) bool {
+	player, ok := s.GetPlayerByNick(nick)
+	if !ok {
+		return false
+	}
+	if err := player.SetPassword(password); err != nil {
+		log.Println(err)
+		return false
+	}
+	return s.SavePlayer(player)
+}
+
+// IsLockedOut reports whether logins for nick are blocked because of too
+// many wrong passwords.
+func (s *Server) IsLockedOut(nick string) bool {
+	s.loginLock.Lock()
+	defer s.loginLock.Unlock()
+	failure, ok := s.loginFailures[nick]
+	return ok && time.Now().Before(failure.until)
+}
+
+// Authenticate checks the password of a loaded player and keeps track of
+// failed attempts.
+func (s *Server) Authenticate(nick string, password string) bool {
+	if s.IsLockedOut(nick) {
+		return false
+	}
+	player, ok := s.GetPlayerByNick(nick)
+	if ok && player.CheckPassword(password) {
+		s.loginLock.Lock()
+		delete(s.loginFailures, nick)
+		s.loginLock.Unlock()
+		return true
+	}
+
+	s.loginLock.Lock()
+	defer s.loginLock.Unlock()
+	failure, ok := s.loginFailures[nick]
+	if !ok {
+		failure = &loginFailure{}
+		s.loginFailures[nick] = failure
+	}
+	failure.count++
+	if failure.count >= MaxLoginFailures {
+		log.Printf("Too many failed logins for %s", nick)
+		failure.count = 0
+		failure.until = time.Now().Add(LoginLockout)
+	}
+	return false
 }
 
-func (s *Server) SavePlayer(player Player) bool {
-	data, err := xml.MarshalIndent(player, "", "    ")
+func (s *Server) SavePlayer(player *Player) bool {
+	data, err := player.marshal()
 	if err == nil {
 		ok, playerFileName := s.getPlayerFileName(player.Nickname)
 		if !ok {
 			return false
 		}
 
-		if ioerror := ioutil.WriteFile(playerFileName, data, 0666); ioerror != nil {
+		// write to a temporary file first, so a concurrent LoadPlayer never
+		// sees a half written file
+		s.saveLock.Lock()
+		defer s.saveLock.Unlock()
+		if ioerror := ioutil.WriteFile(playerFileName+".tmp", data, 0600); ioerror != nil {
 			log.Println(ioerror)
-			return true
+			return false
+		}
+		if ioerror := os.Rename(playerFileName+".tmp", playerFileName); ioerror != nil {
+			log.Println(ioerror)
+			return false
 		}
+		return true
 	} else {
 		log.Println(err)
 	}
 	return false
 }
 
-func (s *Server) OnExit(client Client) {
+func (s *Server) OnExit(client *Client) {
 	s.SavePlayer(client.Player)
 	client.WriteLineToUser(fmt.Sprintf("Good bye %s", client.Player.Gamename))
 }
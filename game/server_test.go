@@ -1,7 +1,19 @@
 package game
 
 import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var usernameTests = []struct {
@@ -34,4 +46,532 @@ func TestLevelIsValidUsername(t *testing.T) {
 			t.Errorf("tests for username %q failed, should be %v", tt.in, tt.out )
 		}
 	}
-}
\ No newline at end of file
+}
+func TestServerAuthenticateLockout(t *testing.T) {
+	s := Server{
+		players:       make(map[string]*Player),
+		loginFailures: make(map[string]*loginFailure),
+	}
+	player := &Player{Nickname: "test"}
+	player.SetPassword("secret")
+	s.addPlayer(player)
+
+	if !s.Authenticate("test", "secret") {
+		t.Error("Should accept the right password")
+	}
+	if s.Authenticate("unknown", "secret") {
+		t.Error("Should not accept unknown players")
+	}
+
+	for i := 0; i < MaxLoginFailures; i++ {
+		if s.IsLockedOut("test") {
+			t.Errorf("Should not be locked after %d failures", i)
+		}
+		if s.Authenticate("test", "wrong") {
+			t.Error("Should not accept a wrong password")
+		}
+	}
+
+	if !s.IsLockedOut("test") {
+		t.Error("Should be locked after too many failures")
+	}
+	if s.Authenticate("test", "secret") {
+		t.Error("Should not accept the right password while locked")
+	}
+	if s.IsLockedOut("unknown") {
+		t.Error("Other players should not be locked")
+	}
+}
+
+func TestServerAccountWithoutPassword(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	s.Config.Admins = []string{"root"}
+
+	lowerPasswordCost(t)
+
+	writeTestFile(t, filepath.Join(s.workingdir, "static", "player", "old.player"),
+		`<player nickname="old" position="A"><name>Old</name><type>hacker</type></player>`)
+	if !s.LoadPlayer("old") {
+		t.Fatal("Accounts without password should be loadable")
+	}
+	for _, password := range []string{"", "secret"} {
+		if s.Authenticate("old", password) {
+			t.Errorf("Accounts without password should not accept %q", password)
+		}
+	}
+	player, _ := s.GetPlayerByNick("old")
+	if player.HasPassword() {
+		t.Error("Logging in should not set a password")
+	}
+
+	output := runTestSessionOutput(s, &Player{Nickname: "alice", Position: "A"}, "setpassword old\nsecret\nsecret\n")
+	if !strings.Contains(output, "Unknown command setpassword.") || player.HasPassword() {
+		t.Errorf("Players should not set passwords of others, got %q", output)
+	}
+
+	output = runTestSessionOutput(s, &Player{Nickname: "root", Position: "A"}, "setpassword old\nsecret\nsecret\n")
+	if !strings.Contains(output, "Password of old changed.") {
+		t.Errorf("Admins should set passwords, got %q", output)
+	}
+	if !s.Authenticate("old", "secret") {
+		t.Error("Accounts should accept the password the admin set")
+	}
+}
+
+// makeTestServer creates a server with two connected rooms in a temporary
+// working directory.
+func makeTestServer(t *testing.T) *Server {
+	dir, err := ioutil.TempDir("", "go-mud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "static", "player"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(dir)
+	a := MakeTestLevel("A", "default")
+	a.Directions = append(a.Directions, MakeTestDirection("B", "East"))
+	b := MakeTestLevel("B", "")
+	b.Directions = append(b.Directions, MakeTestDirection("A", "West"))
+	s.addLevel(a)
+	s.addLevel(b)
+	return s
+}
+
+// runTestSession plays the given input as one connected client.
+func runTestSession(s *Server, player *Player, input string) {
+	conn, peer := net.Pipe()
+	client := NewClient(conn, player)
+	s.StartSession(client)
+	defer s.EndSession(client)
+
+	done := make(chan bool)
+	go func() {
+		client.ReadLinesInto(s)
+		close(done)
+	}()
+	go io.Copy(ioutil.Discard, peer)
+	peer.Write([]byte(input))
+	peer.Close()
+	<-done
+}
+
+// runTestSessionOutput plays the given input as one connected client, quits
+// and returns everything the client got to see.
+func runTestSessionOutput(s *Server, player *Player, input string) string {
+	conn, peer := net.Pipe()
+	client := NewClient(conn, player)
+	s.StartSession(client)
+	defer s.EndSession(client)
+
+	go client.ReadLinesInto(s)
+	go client.WriteLinesFrom(client.Ch)
+	go peer.Write([]byte(input + "quit\n"))
+	output, _ := ioutil.ReadAll(peer)
+	return string(output)
+}
+
+func TestServerConcurrentLogins(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+
+	lowerPasswordCost(t)
+
+	var lock sync.Mutex
+	created := make(map[string]int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// several goroutines share one nickname on purpose
+			nick := fmt.Sprintf("player%d", i%8)
+
+			if s.CreatePlayer(nick, "Name", "hacker", "secret") {
+				lock.Lock()
+				created[nick]++
+				lock.Unlock()
+			}
+			if !s.LoadPlayer(nick) {
+				t.Errorf("%s should be loadable", nick)
+				return
+			}
+			if !s.Authenticate(nick, "secret") {
+				t.Errorf("%s should be able to log in", nick)
+			}
+			player, ok := s.GetPlayerByNick(nick)
+			if !ok {
+				t.Errorf("%s should be loaded", nick)
+				return
+			}
+			if _, ok := s.GetRoom(player.GetPosition()); !ok {
+				t.Errorf("%s should be in a known room, got %q", nick, player.GetPosition())
+			}
+			runTestSession(s, player, "go East\nlook\ngo West\nwho\n")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		nick := fmt.Sprintf("player%d", i)
+		if created[nick] != 1 {
+			t.Errorf("%s should be created exactly once, got %d", nick, created[nick])
+		}
+	}
+}
+
+func TestServerSharesPlayerState(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+
+	lowerPasswordCost(t)
+
+	s.CreatePlayer("alice", "Alice", "hacker", "secret")
+	player, _ := s.GetPlayerByNick("alice")
+	runTestSession(s, player, "go East\n")
+
+	live, _ := s.GetPlayerByNick("alice")
+	if live.GetPosition() != "B" || !live.HasAction("B") {
+		t.Errorf("Server should see the move of the session, got %q", live.GetPosition())
+	}
+
+	s.LoadPlayer("alice")
+	reloaded, _ := s.GetPlayerByNick("alice")
+	if reloaded != player {
+		t.Error("Loading a loaded player again should keep the live instance")
+	}
+
+	runTestSession(s, reloaded, "go West\n")
+	if player.GetPosition() != "A" {
+		t.Errorf("Every session should share one player, got %q", player.GetPosition())
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	s.Config.ShutdownCountdown = 1
+
+	lowerPasswordCost(t)
+
+	s.CreatePlayer("alice", "Alice", "hacker", "secret")
+	player, _ := s.GetPlayerByNick("alice")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() {
+		served <- s.Serve(ln, func(conn net.Conn) {
+			client := NewClient(conn, player)
+			s.StartSession(client)
+			defer s.EndSession(client)
+			go client.ReadLinesInto(s)
+			client.WriteLinesFrom(client.Ch)
+		})
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("go East\n"))
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(line, "RoomB") {
+			break
+		}
+	}
+
+	// not saved by the session, only the shutdown saves it
+	player.UpdateAttribute("score", 5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown should finish in time, got %v", err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("Serve should return ErrServerClosed, got %v", err)
+	}
+
+	rest, _ := ioutil.ReadAll(reader)
+	if !strings.Contains(string(rest), "shuts down in 1 seconds") {
+		t.Errorf("Players should be warned before the shutdown, got %q", rest)
+	}
+	if !strings.Contains(string(rest), "shutting down, good bye") {
+		t.Errorf("Players should be told that the server is gone, got %q", rest)
+	}
+	if _, online := s.IsOnline("alice"); online {
+		t.Error("No session should be left after the shutdown")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.workingdir, "static", "player", "alice.player"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := Player{}
+	if err := xml.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Position != "B" || saved.GetAttribute("score") != 5 {
+		t.Errorf("Shutdown should save the players, got %q with score %d", saved.Position, saved.GetAttribute("score"))
+	}
+
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Error("Shutdown should stop accepting connections")
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	s.Config.IdleTimeout = 2
+	s.Config.IdleWarning = 1
+	s.Config.ReconnectGrace = 60
+
+	lowerPasswordCost(t)
+
+	s.CreatePlayer("alice", "Alice", "hacker", "secret")
+	player, _ := s.GetPlayerByNick("alice")
+
+	conn, peer := net.Pipe()
+	client := NewClient(conn, player)
+	s.StartSession(client)
+	done := make(chan bool)
+	go func() {
+		client.ReadLinesInto(s)
+		s.EndSession(client)
+		close(done)
+	}()
+	player.UpdateAttribute("score", 5)
+
+	output, _ := ioutil.ReadAll(peer)
+	<-done
+
+	if !strings.Contains(string(output), "disconnected in 1 seconds") {
+		t.Errorf("Idle players should be warned, got %q", output)
+	}
+	if !strings.Contains(string(output), "idle for too long") {
+		t.Errorf("Idle players should be disconnected, got %q", output)
+	}
+	if _, online := s.IsOnline("alice"); online {
+		t.Error("An idle session should not wait for a reconnect")
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(s.workingdir, "static", "player", "alice.player"))
+	if !strings.Contains(string(data), "score") {
+		t.Error("Idle players should be saved")
+	}
+}
+
+func TestServerConfigIsAFK(t *testing.T) {
+	config := ServerConfig{AfkTime: 60}
+	if config.IsAFK(Presence{LastActive: time.Now()}) {
+		t.Error("Active players should not be AFK")
+	}
+	if !config.IsAFK(Presence{LastActive: time.Now().Add(-2 * time.Minute)}) {
+		t.Error("Idle players should be AFK")
+	}
+	config.AfkTime = 0
+	if config.IsAFK(Presence{LastActive: time.Now().Add(-2 * time.Minute)}) {
+		t.Error("AFK should be disabled with an AFK time of 0")
+	}
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	levels := filepath.Join(s.workingdir, "static", "levels")
+	config := filepath.Join(s.workingdir, "static", "server.xml")
+
+	writeTestFile(t, config, `<server><name>before</name></server>`)
+	writeTestFile(t, filepath.Join(levels, "a.lvl"), `<station key="A" tag="default"><name>RoomA</name>
+		<directions><direction><name>East</name><station>C</station></direction></directions></station>`)
+	writeTestFile(t, filepath.Join(levels, "c.lvl"), `<station key="C"><name>RoomC</name>
+		<directions><direction><name>West</name><station>A</station></direction></directions></station>`)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.GetRoom("B"); ok {
+		t.Error("Levels that are gone should be removed")
+	}
+	if s.GetName() != "before" {
+		t.Errorf("Reload should read the config, got %q", s.GetName())
+	}
+
+	stays := &Player{Nickname: "stays", Position: "A"}
+	moves := &Player{Nickname: "moves", Position: "C"}
+	s.addPlayer(stays)
+	s.addPlayer(moves)
+
+	writeTestFile(t, config, `<server><name>after</name></server>`)
+	writeTestFile(t, filepath.Join(levels, "c.lvl"), `<station key="C"><name>RoomC</name>
+		<directions><direction><name>West</name><station>X</station></direction></directions></station>`)
+	err := s.Reload()
+	if verr, ok := err.(*ValidationError); !ok || len(verr.Problems) != 1 {
+		t.Errorf("Reload should refuse invalid levels, got %v", err)
+	}
+	if _, ok := s.GetRoom("C"); !ok || s.GetName() != "before" {
+		t.Error("Nothing should change when the levels are invalid")
+	}
+
+	os.Remove(filepath.Join(levels, "c.lvl"))
+	writeTestFile(t, filepath.Join(levels, "a.lvl"), `<station key="A" tag="default"><name>RoomA</name><directions/></station>`)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.GetName() != "after" {
+		t.Errorf("Reload should swap the config, got %q", s.GetName())
+	}
+	if stays.GetPosition() != "A" {
+		t.Errorf("Players in rooms that still exist should stay, got %q", stays.GetPosition())
+	}
+	if moves.GetPosition() != "A" {
+		t.Errorf("Players in rooms that are gone should be moved to the default level, got %q", moves.GetPosition())
+	}
+
+	writeTestFile(t, filepath.Join(levels, "d.lvl"), `<station key="D"><name>RoomD</name><directions/></station>`)
+	if err := s.Reload(); err != nil {
+		t.Errorf("Warnings should not keep levels from being reloaded, got %v", err)
+	}
+	if _, ok := s.GetRoom("D"); !ok {
+		t.Error("Levels with warnings should be loaded")
+	}
+}
+
+func TestServerReloadKeepsItems(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	levels := filepath.Join(s.workingdir, "static", "levels")
+
+	writeTestFile(t, filepath.Join(s.workingdir, "static", "server.xml"), `<server><name>items</name></server>`)
+	writeTestFile(t, filepath.Join(levels, "a.lvl"), `<station key="A" tag="default"><name>RoomA</name>
+		<items><item key="lamp"><name>lamp</name></item><item key="key"><name>key</name></item></items>
+		<directions><direction><name>East</name><station>C</station></direction></directions></station>`)
+	writeTestFile(t, filepath.Join(levels, "c.lvl"), `<station key="C"><name>RoomC</name>
+		<items><item key="iron"><name>iron</name></item></items>
+		<directions><direction><name>West</name><station>A</station></direction></directions></station>`)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	player := &Player{Nickname: "carrier", Position: "A"}
+	s.addPlayer(player)
+	runTestSession(s, player, "get lamp\ngo East\ndrop lamp\n")
+	runTestSession(s, player, "get iron\n")
+
+	writeTestFile(t, filepath.Join(levels, "a.lvl"), `<station key="A" tag="default"><name>RoomA</name>
+		<items><item key="lamp"><name>lamp</name></item><item key="key"><name>key</name></item><item key="coin"><name>coin</name></item></items>
+		<directions><direction><name>East</name><station>C</station></direction></directions></station>`)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(itemNames(s.ItemsInRoom("A")), ","); names != "key,coin" {
+		t.Errorf("Room A should keep its items and get new ones, got %s", names)
+	}
+	if names := strings.Join(itemNames(s.ItemsInRoom("C")), ","); names != "lamp" {
+		t.Errorf("Carried items should not reappear and dropped ones stay, got %s", names)
+	}
+}
+
+func TestServerRestartKeepsItems(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	levels := filepath.Join(s.workingdir, "static", "levels")
+
+	writeTestFile(t, filepath.Join(s.workingdir, "static", "server.xml"), `<server><name>items</name></server>`)
+	writeTestFile(t, filepath.Join(levels, "a.lvl"), `<station key="A" tag="default"><name>RoomA</name>
+		<items><item key="iron"><name>iron</name></item><item key="lamp"><name>lamp</name></item></items>
+		<directions><direction><name>East</name><station>C</station></direction></directions></station>`)
+	writeTestFile(t, filepath.Join(levels, "c.lvl"), `<station key="C"><name>RoomC</name>
+		<directions><direction><name>West</name><station>A</station></direction></directions></station>`)
+
+	s = NewServer(s.workingdir)
+	if err := s.LoadLevels(); err != nil {
+		t.Fatal(err)
+	}
+	player := &Player{Nickname: "carrier", Position: "A"}
+	s.addPlayer(player)
+	runTestSession(s, player, "get iron\nget lamp\ngo East\ndrop lamp\n")
+
+	// a new server reads the same files like after a restart
+	restarted := NewServer(s.workingdir)
+	if err := restarted.LoadLevels(); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.LoadPlayer("carrier") {
+		t.Fatal("Player should be saved")
+	}
+	carrier, _ := restarted.GetPlayerByNick("carrier")
+
+	count := make(map[string]int)
+	for _, room := range []string{"A", "C"} {
+		for _, item := range restarted.ItemsInRoom(room) {
+			count[item.Key]++
+		}
+	}
+	for _, key := range carrier.GetInventory() {
+		count[key]++
+	}
+	if count["iron"] != 1 || count["lamp"] != 1 {
+		t.Errorf("Every item should exist once after a restart, got %v", count)
+	}
+	if names := strings.Join(itemNames(restarted.ItemsInRoom("C")), ","); names != "lamp" {
+		t.Errorf("Dropped items should stay where they were dropped, got %q", names)
+	}
+}
+
+func TestServerTimeZone(t *testing.T) {
+	s := makeTestServer(t)
+	defer os.RemoveAll(s.workingdir)
+	config := filepath.Join(s.workingdir, "static", "server.xml")
+	s.Clock = func() time.Time {
+		return time.Date(2016, 4, 1, 14, 0, 0, 0, time.UTC)
+	}
+
+	writeTestFile(t, config, `<server><timeZone>Asia/Tokyo</timeZone></server>`)
+	if err := s.LoadConfig(); err != nil {
+		t.Skip(err)
+	}
+	if now := s.Moment().Now; now.Hour() != 23 {
+		t.Errorf("It should be 23:00 in Tokyo, got %s", now.Format("15:04"))
+	}
+
+	a, _ := s.GetRoom("A")
+	a.Actions = append(a.Actions, Action{
+		Name:   "party",
+		Answer: "Party!",
+		Dependencies: []Dependency{
+			{Type: "time", MinValue: "22:00", MaxValue: "04:00", FailMessage: "Too early."},
+		},
+	})
+	s.addLevel(a)
+
+	output := runTestSessionOutput(s, &Player{Nickname: "night", Position: "A"}, "party\n")
+	if !strings.Contains(output, "Party!") {
+		t.Errorf("Time dependencies should use the time zone of the world, got %q", output)
+	}
+
+	writeTestFile(t, config, `<server><timeZone>Middle/Earth</timeZone></server>`)
+	if err := s.LoadConfig(); err == nil {
+		t.Error("Unknown time zones should not be loaded")
+	}
+}
@@ -0,0 +1,81 @@
+package game
+
+import (
+	"sort"
+	"strings"
+)
+
+// editDistance is the optimal string alignment distance between a and b:
+// the Levenshtein distance that also counts swapping two neighbouring
+// letters as one edit. It is case insensitive.
+func editDistance(a string, b string) int {
+	ra := []rune(strings.ToLower(a))
+	rb := []rune(strings.ToLower(b))
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// Suggest picks the candidates that are close to the input, best matches
+// first. Longer inputs allow more typos.
+func Suggest(input string, candidates []string) []string {
+	maxDistance := 1
+	if len([]rune(input)) > 5 {
+		maxDistance = 2
+	}
+
+	distances := make(map[string]int)
+	var suggestions []string
+	for _, candidate := range candidates {
+		if _, ok := distances[candidate]; ok {
+			continue
+		}
+		if d := editDistance(input, candidate); d <= maxDistance {
+			distances[candidate] = d
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if distances[a] != distances[b] {
+			return distances[a] < distances[b]
+		}
+		return a < b
+	})
+	return suggestions
+}
+
+// didYouMean formats suggestions as a question, it is empty without any.
+func didYouMean(suggestions []string) string {
+	switch len(suggestions) {
+	case 0:
+		return ""
+	case 1:
+		return "Did you mean " + suggestions[0] + "?"
+	}
+	return "Did you mean " + strings.Join(suggestions[:len(suggestions)-1], ", ") + " or " + suggestions[len(suggestions)-1] + "?"
+}
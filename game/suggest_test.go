@@ -0,0 +1,56 @@
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+var editDistanceTests = []struct {
+	a, b string
+	out  int
+}{
+	{"", "", 0},
+	{"look", "look", 0},
+	{"look", "LOOK", 0},
+	{"lok", "look", 1},
+	{"loko", "look", 1},
+	{"lkoo", "look", 2},
+	{"Esat", "East", 1},
+	{"ca", "abc", 3},
+	{"kitten", "sitting", 3},
+	{"", "go", 2},
+	{"solder", "", 6},
+	{"süd", "sud", 1},
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range editDistanceTests {
+		if d := editDistance(tt.a, tt.b); d != tt.out {
+			t.Errorf("edit distance of %q and %q is %d, should be %d", tt.a, tt.b, d, tt.out)
+		}
+	}
+}
+
+var suggestTests = []struct {
+	in  string
+	out string
+}{
+	{"lok", "look"},
+	{"shuot", "shout"},
+	{"shoot", "shout"},
+	{"soldr", "solder"},
+	{"soldeer", "solder"},
+	{"sodlre", "solder"},
+	{"sdolre", ""},
+	{"wo", "go,who"},
+	{"xyz", ""},
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"look", "watch", "go", "shout", "who", "solder", "look"}
+	for _, tt := range suggestTests {
+		if got := strings.Join(Suggest(tt.in, candidates), ","); got != tt.out {
+			t.Errorf("suggestions for %q are %q, should be %q", tt.in, got, tt.out)
+		}
+	}
+}
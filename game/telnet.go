@@ -0,0 +1,378 @@
+package game
+
+import (
+	"net"
+	"sync"
+)
+
+// Telnet command bytes (RFC 854)
+const (
+	TelnetSE   byte = 240
+	TelnetNOP  byte = 241
+	TelnetGA   byte = 249
+	TelnetSB   byte = 250
+	TelnetWILL byte = 251
+	TelnetWONT byte = 252
+	TelnetDO   byte = 253
+	TelnetDONT byte = 254
+	TelnetIAC  byte = 255
+)
+
+// Telnet options the server knows about
+const (
+	TelnetOptEcho            byte = 1
+	TelnetOptSuppressGoAhead byte = 3
+	TelnetOptNAWS            byte = 31
+)
+
+const (
+	telnetStateData = iota
+	telnetStateCR
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSB
+	telnetStateSBData
+	telnetStateSBIAC
+)
+
+// maxSubnegotiation limits the data of one subnegotiation, NAWS needs 4
+// bytes. Longer subnegotiations are dropped.
+const maxSubnegotiation = 256
+
+// telnetOption keeps the negotiation state of one option on one side of
+// the connection. pending is set while we wait for the answer to our own
+// request so that the answer is not acknowledged again (RFC 1143).
+type telnetOption struct {
+	accept  bool
+	enabled bool
+	pending bool
+}
+
+// TelnetConn sits between the raw net.Conn and the game Client. Reads
+// return only the user data, all IAC sequences are consumed and answered,
+// writes escape IAC bytes.
+type TelnetConn struct {
+	net.Conn
+
+	readBuf  []byte
+	state    int
+	verb     byte
+	sbOption byte
+	sbData   []byte
+	// sbTooLong is set when the subnegotiation exceeds maxSubnegotiation
+	sbTooLong bool
+
+	writeLock sync.Mutex
+	optLock   sync.Mutex
+	local     map[byte]*telnetOption
+	remote    map[byte]*telnetOption
+	handlers  map[byte]func(data []byte)
+	width     int
+	height    int
+}
+
+func NewTelnetConn(c net.Conn) *TelnetConn {
+	return &TelnetConn{
+		Conn:     c,
+		local:    make(map[byte]*telnetOption),
+		remote:   make(map[byte]*telnetOption),
+		handlers: make(map[byte]func(data []byte)),
+	}
+}
+
+func (t *TelnetConn) option(options map[byte]*telnetOption, opt byte) *telnetOption {
+	o, ok := options[opt]
+	if !ok {
+		o = &telnetOption{}
+		options[opt] = o
+	}
+	return o
+}
+
+// AcceptLocal lets the peer enable opt on our side with DO.
+func (t *TelnetConn) AcceptLocal(opt byte) {
+	t.optLock.Lock()
+	t.option(t.local, opt).accept = true
+	t.optLock.Unlock()
+}
+
+// AcceptRemote lets the peer enable opt on its side with WILL.
+func (t *TelnetConn) AcceptRemote(opt byte) {
+	t.optLock.Lock()
+	t.option(t.remote, opt).accept = true
+	t.optLock.Unlock()
+}
+
+func (t *TelnetConn) LocalEnabled(opt byte) bool {
+	t.optLock.Lock()
+	defer t.optLock.Unlock()
+	return t.option(t.local, opt).enabled
+}
+
+func (t *TelnetConn) RemoteEnabled(opt byte) bool {
+	t.optLock.Lock()
+	defer t.optLock.Unlock()
+	return t.option(t.remote, opt).enabled
+}
+
+// OnSubnegotiation registers a handler for the data of IAC SB opt ... IAC SE.
+// The handler runs inside Read.
+func (t *TelnetConn) OnSubnegotiation(opt byte, handler func(data []byte)) {
+	t.optLock.Lock()
+	t.handlers[opt] = handler
+	t.optLock.Unlock()
+}
+
+// Will offers to enable opt on our side.
+func (t *TelnetConn) Will(opt byte) error {
+	return t.request(t.local, opt, true, TelnetWILL, TelnetWONT)
+}
+
+// Wont disables opt on our side.
+func (t *TelnetConn) Wont(opt byte) error {
+	return t.request(t.local, opt, false, TelnetWILL, TelnetWONT)
+}
+
+// Do asks the peer to enable opt on its side.
+func (t *TelnetConn) Do(opt byte) error {
+	return t.request(t.remote, opt, true, TelnetDO, TelnetDONT)
+}
+
+// Dont asks the peer to disable opt on its side.
+func (t *TelnetConn) Dont(opt byte) error {
+	return t.request(t.remote, opt, false, TelnetDO, TelnetDONT)
+}
+
+func (t *TelnetConn) request(options map[byte]*telnetOption, opt byte, enable bool, yes byte, no byte) error {
+	t.optLock.Lock()
+	o := t.option(options, opt)
+	if enable {
+		o.accept = true
+	}
+	if o.enabled == enable || o.pending {
+		t.optLock.Unlock()
+		return nil
+	}
+	verb := no
+	if enable {
+		verb = yes
+		o.pending = true
+	} else {
+		o.enabled = false
+	}
+	t.optLock.Unlock()
+
+	return t.writeRaw([]byte{TelnetIAC, verb, opt})
+}
+
+// SendSubnegotiation writes IAC SB opt data IAC SE.
+func (t *TelnetConn) SendSubnegotiation(opt byte, data []byte) error {
+	msg := []byte{TelnetIAC, TelnetSB, opt}
+	msg = append(msg, escapeIAC(data)...)
+	msg = append(msg, TelnetIAC, TelnetSE)
+	return t.writeRaw(msg)
+}
+
+// SuppressEcho tells the client that the server takes over echoing, so
+// the client stops printing what the user types (e.g. passwords).
+func (t *TelnetConn) SuppressEcho(suppress bool) error {
+	if suppress {
+		return t.Will(TelnetOptEcho)
+	}
+	return t.Wont(TelnetOptEcho)
+}
+
+// RequestWindowSize asks the peer to report its terminal size with NAWS
+// (RFC 1073). The size is updated whenever the peer sends a new one.
+func (t *TelnetConn) RequestWindowSize() error {
+	t.OnSubnegotiation(TelnetOptNAWS, func(data []byte) {
+		if len(data) != 4 {
+			return
+		}
+		t.optLock.Lock()
+		t.width = int(data[0])<<8 | int(data[1])
+		t.height = int(data[2])<<8 | int(data[3])
+		t.optLock.Unlock()
+	})
+	return t.Do(TelnetOptNAWS)
+}
+
+// WindowSize returns the last terminal size the peer reported, zero if it
+// never did.
+func (t *TelnetConn) WindowSize() (int, int) {
+	t.optLock.Lock()
+	defer t.optLock.Unlock()
+	return t.width, t.height
+}
+
+// Read returns the next chunk of user data. It blocks until at least one
+// data byte arrived, negotiation only input is answered and swallowed.
+func (t *TelnetConn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(t.readBuf) < len(p) {
+		t.readBuf = make([]byte, len(p))
+	}
+	for {
+		n, err := t.Conn.Read(t.readBuf[:len(p)])
+		data := t.parse(t.readBuf[:n], p[:0])
+		if len(data) > 0 || err != nil {
+			return len(data), err
+		}
+	}
+}
+
+// Write sends p to the peer, doubling every IAC byte.
+func (t *TelnetConn) Write(p []byte) (int, error) {
+	if err := t.writeRaw(escapeIAC(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *TelnetConn) writeRaw(p []byte) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	_, err := t.Conn.Write(p)
+	return err
+}
+
+func escapeIAC(p []byte) []byte {
+	escaped := make([]byte, 0, len(p))
+	for _, b := range p {
+		escaped = append(escaped, b)
+		if b == TelnetIAC {
+			escaped = append(escaped, TelnetIAC)
+		}
+	}
+	return escaped
+}
+
+// parse runs the telnet state machine over in and appends the user data
+// to out. out never grows longer than in.
+func (t *TelnetConn) parse(in []byte, out []byte) []byte {
+	for _, b := range in {
+		switch t.state {
+		case telnetStateCR:
+			t.state = telnetStateData
+			if b == 0 {
+				// CR NUL is a bare carriage return
+				continue
+			}
+			out = t.parseData(b, out)
+		case telnetStateData:
+			out = t.parseData(b, out)
+		case telnetStateIAC:
+			t.state = telnetStateData
+			switch b {
+			case TelnetIAC:
+				out = append(out, TelnetIAC)
+			case TelnetWILL, TelnetWONT, TelnetDO, TelnetDONT:
+				t.verb = b
+				t.state = telnetStateOption
+			case TelnetSB:
+				t.state = telnetStateSB
+			}
+		case telnetStateOption:
+			t.state = telnetStateData
+			t.negotiate(t.verb, b)
+		case telnetStateSB:
+			t.sbOption = b
+			t.sbData = t.sbData[:0]
+			t.sbTooLong = false
+			t.state = telnetStateSBData
+		case telnetStateSBData:
+			if b == TelnetIAC {
+				t.state = telnetStateSBIAC
+			} else {
+				t.appendSubnegotiation(b)
+			}
+		case telnetStateSBIAC:
+			switch b {
+			case TelnetIAC:
+				t.appendSubnegotiation(TelnetIAC)
+				t.state = telnetStateSBData
+			case TelnetSE:
+				t.state = telnetStateData
+				if !t.sbTooLong {
+					t.subnegotiation(t.sbOption, t.sbData)
+				}
+			default:
+				// broken subnegotiation, drop it
+				t.state = telnetStateData
+			}
+		}
+	}
+	return out
+}
+
+// appendSubnegotiation collects the data of a subnegotiation until it gets
+// too long, the rest is skipped until IAC SE.
+func (t *TelnetConn) appendSubnegotiation(b byte) {
+	if len(t.sbData) >= maxSubnegotiation {
+		t.sbTooLong = true
+		return
+	}
+	t.sbData = append(t.sbData, b)
+}
+
+func (t *TelnetConn) parseData(b byte, out []byte) []byte {
+	switch b {
+	case TelnetIAC:
+		t.state = telnetStateIAC
+		return out
+	case '\r':
+		t.state = telnetStateCR
+	}
+	return append(out, b)
+}
+
+func (t *TelnetConn) negotiate(verb byte, opt byte) {
+	var options map[byte]*telnetOption
+	var yes, no byte
+	switch verb {
+	case TelnetWILL, TelnetWONT:
+		options, yes, no = t.remote, TelnetDO, TelnetDONT
+	default:
+		options, yes, no = t.local, TelnetWILL, TelnetWONT
+	}
+
+	t.optLock.Lock()
+	o := t.option(options, opt)
+	var reply byte
+	if verb == TelnetWILL || verb == TelnetDO {
+		switch {
+		case o.enabled:
+		case o.pending:
+			o.enabled, o.pending = true, false
+		case o.accept:
+			o.enabled = true
+			reply = yes
+		default:
+			reply = no
+		}
+	} else {
+		switch {
+		case o.pending:
+			o.pending = false
+		case o.enabled:
+			o.enabled = false
+			reply = no
+		}
+	}
+	t.optLock.Unlock()
+
+	if reply != 0 {
+		t.writeRaw([]byte{TelnetIAC, reply, opt})
+	}
+}
+
+func (t *TelnetConn) subnegotiation(opt byte, data []byte) {
+	t.optLock.Lock()
+	handler, ok := t.handlers[opt]
+	t.optLock.Unlock()
+	if ok {
+		handler(append([]byte(nil), data...))
+	}
+}
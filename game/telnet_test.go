@@ -0,0 +1,188 @@
+package game
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+// runTelnetScript feeds input into a TelnetConn through a net.Pipe and
+// returns the user data read from it and the raw negotiation replies the
+// peer received. The input has to end with a newline.
+func runTelnetScript(t *testing.T, setup func(tc *TelnetConn), input []byte) ([]byte, []byte) {
+	server, peer := net.Pipe()
+	tc := NewTelnetConn(server)
+
+	replies := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(peer)
+		replies <- data
+	}()
+	if setup != nil {
+		setup(tc)
+	}
+	go peer.Write(input)
+
+	var data []byte
+	buf := make([]byte, 4)
+	for !bytes.HasSuffix(data, []byte("\n")) {
+		n, err := tc.Read(buf)
+		data = append(data, buf[:n]...)
+		if err != nil {
+			t.Fatalf("unexpected read error: %v", err)
+		}
+	}
+	server.Close()
+
+	return data, <-replies
+}
+
+var telnetTests = []struct {
+	name    string
+	input   []byte
+	data    []byte
+	replies []byte
+}{
+	{"plain", []byte("look\r\n"), []byte("look\r\n"), nil},
+	{"escaped IAC", []byte{'a', TelnetIAC, TelnetIAC, 'b', '\n'}, []byte{'a', TelnetIAC, 'b', '\n'}, nil},
+	{"CR NUL", []byte{'a', '\r', 0, 'b', '\n'}, []byte{'a', '\r', 'b', '\n'}, nil},
+	{"NOP", []byte{'a', TelnetIAC, TelnetNOP, 'b', '\n'}, []byte("ab\n"), nil},
+	{"refuse WILL", []byte{TelnetIAC, TelnetWILL, 42, 'a', '\n'}, []byte("a\n"), []byte{TelnetIAC, TelnetDONT, 42}},
+	{"refuse DO", []byte{TelnetIAC, TelnetDO, 42, 'a', '\n'}, []byte("a\n"), []byte{TelnetIAC, TelnetWONT, 42}},
+	{"ignore WONT", []byte{TelnetIAC, TelnetWONT, 42, 'a', '\n'}, []byte("a\n"), nil},
+	{"skip subnegotiation", []byte{'a', TelnetIAC, TelnetSB, 42, 1, 2, TelnetIAC, TelnetSE, 'b', '\n'}, []byte("ab\n"), nil},
+}
+
+func TestTelnetScripts(t *testing.T) {
+	for _, tt := range telnetTests {
+		data, replies := runTelnetScript(t, nil, tt.input)
+		if !bytes.Equal(data, tt.data) {
+			t.Errorf("%s: got data %v, should be %v", tt.name, data, tt.data)
+		}
+		if !bytes.Equal(replies, tt.replies) {
+			t.Errorf("%s: got replies %v, should be %v", tt.name, replies, tt.replies)
+		}
+	}
+}
+
+func TestTelnetAcceptRemote(t *testing.T) {
+	input := []byte{TelnetIAC, TelnetWILL, TelnetOptNAWS, TelnetIAC, TelnetWILL, TelnetOptNAWS, '\n'}
+
+	var tc *TelnetConn
+	_, replies := runTelnetScript(t, func(c *TelnetConn) {
+		tc = c
+		c.AcceptRemote(TelnetOptNAWS)
+	}, input)
+
+	if !bytes.Equal(replies, []byte{TelnetIAC, TelnetDO, TelnetOptNAWS}) {
+		t.Errorf("Should acknowledge WILL exactly once, got %v", replies)
+	}
+	if !tc.RemoteEnabled(TelnetOptNAWS) {
+		t.Error("NAWS should be enabled")
+	}
+}
+
+func TestTelnetOwnRequestIsNotAcknowledged(t *testing.T) {
+	server, peer := net.Pipe()
+	defer peer.Close()
+	tc := NewTelnetConn(server)
+
+	go tc.Do(TelnetOptNAWS)
+	request := make([]byte, 3)
+	if _, err := peer.Read(request); err != nil || !bytes.Equal(request, []byte{TelnetIAC, TelnetDO, TelnetOptNAWS}) {
+		t.Fatalf("Should send DO NAWS, got %v", request)
+	}
+
+	replies := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(peer)
+		replies <- data
+	}()
+	go peer.Write([]byte{TelnetIAC, TelnetWILL, TelnetOptNAWS, '\n'})
+
+	buf := make([]byte, 8)
+	n, _ := tc.Read(buf)
+	if string(buf[:n]) != "\n" {
+		t.Errorf("Should only read the newline, got %v", buf[:n])
+	}
+	server.Close()
+
+	if data := <-replies; len(data) != 0 {
+		t.Errorf("Should not answer the acknowledgement, got %v", data)
+	}
+	if !tc.RemoteEnabled(TelnetOptNAWS) {
+		t.Error("NAWS should be enabled")
+	}
+}
+
+func TestTelnetSubnegotiationHandler(t *testing.T) {
+	input := []byte{TelnetIAC, TelnetSB, TelnetOptNAWS, 0, 80, 0, TelnetIAC, TelnetIAC, TelnetIAC, TelnetSE, '\n'}
+
+	var got []byte
+	runTelnetScript(t, func(c *TelnetConn) {
+		c.OnSubnegotiation(TelnetOptNAWS, func(data []byte) {
+			got = data
+		})
+	}, input)
+
+	if !bytes.Equal(got, []byte{0, 80, 0, TelnetIAC}) {
+		t.Errorf("Should get unescaped subnegotiation data, got %v", got)
+	}
+}
+
+func TestTelnetSubnegotiationTooLong(t *testing.T) {
+	input := []byte{'a', TelnetIAC, TelnetSB, TelnetOptNAWS}
+	input = append(input, bytes.Repeat([]byte{1}, 10000)...)
+	input = append(input, TelnetIAC, TelnetSE, 'b', '\n')
+
+	called := false
+	var tc *TelnetConn
+	data, _ := runTelnetScript(t, func(c *TelnetConn) {
+		tc = c
+		c.OnSubnegotiation(TelnetOptNAWS, func(data []byte) {
+			called = true
+		})
+	}, input)
+
+	if !bytes.Equal(data, []byte("ab\n")) {
+		t.Errorf("Data around a long subnegotiation should be kept, got %q", data)
+	}
+	if called {
+		t.Error("Too long subnegotiations should be dropped")
+	}
+	if cap(tc.sbData) > 2*maxSubnegotiation {
+		t.Errorf("Subnegotiation buffer should be limited, got %d bytes", cap(tc.sbData))
+	}
+}
+
+func TestTelnetWriteEscapesIAC(t *testing.T) {
+	server, peer := net.Pipe()
+	defer peer.Close()
+	tc := NewTelnetConn(server)
+
+	go func() {
+		tc.Write([]byte{'a', TelnetIAC, 'b'})
+		server.Close()
+	}()
+
+	data, _ := ioutil.ReadAll(peer)
+	if !bytes.Equal(data, []byte{'a', TelnetIAC, TelnetIAC, 'b'}) {
+		t.Errorf("Should escape IAC, got %v", data)
+	}
+}
+
+func TestTelnetWindowSize(t *testing.T) {
+	input := []byte{TelnetIAC, TelnetWILL, TelnetOptNAWS, TelnetIAC, TelnetSB, TelnetOptNAWS, 0, 120, 0, 40, TelnetIAC, TelnetSE, '\n'}
+
+	var tc *TelnetConn
+	runTelnetScript(t, func(c *TelnetConn) {
+		tc = c
+		c.RequestWindowSize()
+	}, input)
+
+	width, height := tc.WindowSize()
+	if width != 120 || height != 40 {
+		t.Errorf("Should get 120x40 as window size, got %dx%d", width, height)
+	}
+}
@@ -0,0 +1,383 @@
+package game
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem is an error in the level files found by ValidateLevels. Warnings
+// point at likely mistakes, the levels still work with them.
+type Problem struct {
+	File    string
+	Level   string
+	Message string
+	Warning bool
+}
+
+func problemf(format string, args ...interface{}) Problem {
+	return Problem{Message: fmt.Sprintf(format, args...)}
+}
+
+func warningf(format string, args ...interface{}) Problem {
+	return Problem{Message: fmt.Sprintf(format, args...), Warning: true}
+}
+
+// Errors returns the problems that are no warnings.
+func Errors(problems []Problem) []Problem {
+	var errors []Problem
+	for _, p := range problems {
+		if !p.Warning {
+			errors = append(errors, p)
+		}
+	}
+	return errors
+}
+
+// ValidationError is returned when levels are not loaded because of
+// errors.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid levels: " + e.Problems[0].String()
+	}
+	return fmt.Sprintf("invalid levels: %s and %d more problem(s)", e.Problems[0], len(e.Problems)-1)
+}
+
+func (p Problem) String() string {
+	message := p.Message
+	if p.Warning {
+		message = "warning: " + message
+	}
+	if p.Level == "" {
+		return fmt.Sprintf("%s: %s", p.File, message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Level, message)
+}
+
+// dependencyTypes are the types CheckDependencies knows.
+var dependencyTypes = map[string]bool{
+	"":           true,
+	"action":     true,
+	"attribute":  true,
+	"time":       true,
+	"date":       true,
+	"item":       true,
+	"expression": true,
+	"gametime":   true,
+}
+
+type levelFile struct {
+	file  string
+	level Level
+}
+
+// ValidateLevels loads all level files of dir and reports the problems a
+// running server would silently ignore.
+func ValidateLevels(dir string) ([]Problem, error) {
+	files, problems, err := loadLevelFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, validateLevels(files)...), nil
+}
+
+// loadLevelFiles reads all level files of dir, files that can not be read
+// are reported as problems.
+func loadLevelFiles(dir string) ([]levelFile, []Problem, error) {
+	var files []levelFile
+	var problems []Problem
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, _ := filepath.Rel(dir, path)
+		level, err := readLevel(path)
+		if err != nil {
+			problems = append(problems, Problem{File: name, Message: err.Error()})
+			return nil
+		}
+		files = append(files, levelFile{file: name, level: level})
+		return nil
+	})
+	return files, problems, err
+}
+
+func validateLevels(files []levelFile) []Problem {
+	var problems []Problem
+	add := func(f levelFile, context string, found ...Problem) {
+		for _, p := range found {
+			p.File = f.file
+			p.Level = f.level.Key
+			if context != "" {
+				p.Message = context + ": " + p.Message
+			}
+			problems = append(problems, p)
+		}
+	}
+	report := func(f levelFile, format string, args ...interface{}) {
+		add(f, "", problemf(format, args...))
+	}
+
+	levels := make(map[string]levelFile)
+	var defaults []string
+	for _, f := range files {
+		if f.level.Key == "" {
+			report(f, "level has no key")
+			continue
+		}
+		if other, ok := levels[f.level.Key]; ok {
+			report(f, "key is used by %s already", other.file)
+			continue
+		}
+		levels[f.level.Key] = f
+		if f.level.Tag == "default" {
+			defaults = append(defaults, f.file)
+		}
+	}
+	switch {
+	case len(files) > 0 && len(defaults) == 0:
+		problems = append(problems, Problem{File: "-", Message: "no level is tagged as default"})
+	case len(defaults) > 1:
+		problems = append(problems, Problem{File: "-", Message: "more than one level is tagged as default: " + strings.Join(defaults, ", ")})
+	}
+
+	// players log the key of every level they enter and level:action for
+	// every action they do, effects grant actions and change attributes
+	produced := make(map[string]bool)
+	attributes := make(map[string]bool)
+	for key, f := range levels {
+		produced[strings.ToLower(key)] = true
+		for _, a := range f.level.Actions {
+			produced[strings.ToLower(f.level.GetRoomActionName(a))] = true
+			for _, e := range a.Effects {
+				switch {
+				case e.Type == "action" && e.op() == "grant":
+					produced[strings.ToLower(e.Key)] = true
+				case e.Type == "attribute":
+					attributes[strings.ToLower(e.Key)] = true
+				}
+			}
+		}
+	}
+
+	items := make(map[string]levelFile)
+	for _, f := range files {
+		for _, item := range f.level.Items {
+			if item.Key == "" {
+				report(f, "item %q has no key", item.Name)
+				continue
+			}
+			if other, ok := items[item.Key]; ok {
+				report(f, "item key %q is used by %s already", item.Key, other.file)
+				continue
+			}
+			items[item.Key] = f
+		}
+	}
+	check := func(conditions DependencyGroup) []Problem {
+		dependencies := conditions.Flatten()
+		problems := validateDependencies(dependencies, produced, attributes)
+		problems = append(problems, emptyGroups(conditions)...)
+		for _, d := range dependencies {
+			if _, ok := items[d.Key]; d.Type == "item" && !ok {
+				problems = append(problems, warningf("unknown item %q", d.Key))
+			}
+			if expression, err := ParseExpression(d.Expression); d.Expression != "" && err == nil {
+				for _, key := range expression.Keys("item") {
+					if _, ok := items[key]; !ok {
+						problems = append(problems, warningf("unknown item %q", key))
+					}
+				}
+			}
+		}
+		return problems
+	}
+
+	for _, f := range files {
+		for _, d := range f.level.Directions {
+			if _, ok := levels[d.Station]; !ok {
+				report(f, "direction %s leads to unknown station %q", d.Direction, d.Station)
+			}
+			add(f, "direction "+d.Direction, check(d.Conditions())...)
+		}
+		for _, a := range f.level.Actions {
+			add(f, "action "+a.Name, check(a.Conditions())...)
+			for _, e := range a.Effects {
+				if err := e.validate(); err != nil {
+					report(f, "action %s: %s", a.Name, err)
+					continue
+				}
+				if _, ok := levels[e.Key]; e.Type == "teleport" && !ok {
+					report(f, "action %s: teleport to unknown station %q", a.Name, e.Key)
+				}
+				if _, ok := items[e.Key]; e.Type == "item" && !ok {
+					report(f, "action %s: unknown item %q", a.Name, e.Key)
+				}
+			}
+		}
+		for i, m := range f.level.Messages {
+			add(f, fmt.Sprintf("message %d", i+1), check(m.Conditions())...)
+		}
+	}
+
+	if len(defaults) == 1 {
+		reachable := reachableLevels(levels, levels[defaultKey(files)].level.Key)
+		for _, f := range files {
+			if f.level.Key != "" && !reachable[f.level.Key] && levels[f.level.Key].file == f.file {
+				add(f, "", warningf("level can not be reached from the default level"))
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].File < problems[j].File
+	})
+	return problems
+}
+
+func defaultKey(files []levelFile) string {
+	for _, f := range files {
+		if f.level.Tag == "default" {
+			return f.level.Key
+		}
+	}
+	return ""
+}
+
+// reachableLevels follows all directions from start, dependencies are
+// ignored.
+func reachableLevels(levels map[string]levelFile, start string) map[string]bool {
+	reachable := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		for _, d := range levels[key].level.Directions {
+			if _, ok := levels[d.Station]; ok && !reachable[d.Station] {
+				reachable[d.Station] = true
+				queue = append(queue, d.Station)
+			}
+		}
+	}
+	return reachable
+}
+
+// validateDependencies checks type and values of dependencies, action
+// dependencies must name something a player can do.
+func validateDependencies(dependencies []Dependency, produced map[string]bool, attributes map[string]bool) []Problem {
+	var problems []Problem
+	for _, d := range dependencies {
+		if !dependencyTypes[d.Type] {
+			problems = append(problems, problemf("unknown dependency type %q", d.Type))
+			continue
+		}
+		if d.Expression != "" {
+			problems = append(problems, validateExpression(d.Expression, produced, attributes)...)
+		}
+		switch d.kind() {
+		case "", "action":
+			if !produced[strings.ToLower(d.Key)] {
+				problems = append(problems, warningf("no level or action produces dependency key %q", d.Key))
+			}
+		case "attribute":
+			if !attributes[strings.ToLower(d.Key)] {
+				problems = append(problems, warningf("no action changes attribute %q", d.Key))
+			}
+			for _, value := range []string{d.MinValue, d.MaxValue} {
+				if _, err := strconv.ParseInt(value, 10, 64); value != "" && err != nil {
+					problems = append(problems, problemf("attribute value %q is not a number", value))
+				}
+			}
+		case "time":
+			if d.MinValue != "" || d.MaxValue != "" || d.Days == "" {
+				for _, value := range []string{d.MinValue, d.MaxValue} {
+					if _, ok := parseClock(value); !ok {
+						problems = append(problems, problemf("time %q is not formatted as HH:MM", value))
+					}
+				}
+			}
+			if _, err := parseWeekdays(d.Days); d.Days != "" && err != nil {
+				problems = append(problems, problemf("%s", err))
+			}
+		case "gametime":
+			if d.Key == "" && d.MinValue == "" && d.MaxValue == "" && d.Days == "" {
+				problems = append(problems, problemf("gametime dependency needs a phase key or times"))
+			}
+			for _, phase := range strings.Split(d.Key, ",") {
+				if d.Key != "" && !validPhase(phase) {
+					problems = append(problems, problemf("unknown phase %q, phases are dawn, day, dusk and night", strings.TrimSpace(phase)))
+				}
+			}
+			if d.MinValue != "" || d.MaxValue != "" {
+				for _, value := range []string{d.MinValue, d.MaxValue} {
+					if _, ok := parseClock(value); !ok {
+						problems = append(problems, problemf("time %q is not formatted as HH:MM", value))
+					}
+				}
+			}
+			if _, err := parseWeekdays(d.Days); d.Days != "" && err != nil {
+				problems = append(problems, problemf("%s", err))
+			}
+		case "expression":
+			if d.Expression == "" {
+				problems = append(problems, problemf("expression dependency has no <expression>"))
+			}
+		case "date":
+			for _, value := range []string{d.MinValue, d.MaxValue} {
+				if _, err := time.Parse("2006-01-02", value); err != nil {
+					problems = append(problems, problemf("date %q is not formatted as YYYY-MM-DD", value))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// validateExpression parses an expression and checks the actions and
+// attributes it asks for like validateDependencies does.
+func validateExpression(source string, produced map[string]bool, attributes map[string]bool) []Problem {
+	expression, err := ParseExpression(source)
+	if err != nil {
+		return []Problem{problemf("%s", err)}
+	}
+	var problems []Problem
+	for _, key := range expression.Keys("has") {
+		if !produced[strings.ToLower(key)] {
+			problems = append(problems, warningf("no level or action produces dependency key %q", key))
+		}
+	}
+	for _, key := range expression.Keys("attr") {
+		if !attributes[strings.ToLower(key)] {
+			problems = append(problems, warningf("no action changes attribute %q", key))
+		}
+	}
+	return problems
+}
+
+// emptyGroups reports nested <all>, <any> and <not> groups without any
+// dependencies, they are always or never met which is likely a mistake.
+func emptyGroups(g DependencyGroup) []Problem {
+	var problems []Problem
+	for _, c := range g.conditions() {
+		if c.kind == "dependency" {
+			continue
+		}
+		if c.group.IsEmpty() {
+			problems = append(problems, warningf("empty <%s> group", c.kind))
+			continue
+		}
+		problems = append(problems, emptyGroups(c.group)...)
+	}
+	return problems
+}
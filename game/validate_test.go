@@ -0,0 +1,269 @@
+package game
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestValidateShippedLevels(t *testing.T) {
+	problems, err := ValidateLevels("../static/levels/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Errorf("Shipped levels should be valid, got %s", p)
+	}
+}
+
+func TestValidateLevels(t *testing.T) {
+	a := MakeTestLevel("A", "default")
+	a.Directions = []Direction{
+		MakeTestDirection("B", "East"),
+		MakeTestDirection("X", "West"),
+	}
+	a.Actions = []Action{{
+		Name: "solder",
+		Dependencies: []Dependency{
+			{Key: "B"},
+			{Key: "B:hack", Type: "action"},
+			{Key: "strength", Type: "attribute", MinValue: "ten"},
+			{Type: "tmie"},
+		},
+	}}
+	b := MakeTestLevel("B", "")
+	b.Actions = []Action{{Name: "Hack"}}
+	b.Directions = []Direction{{Station: "A", Direction: "West", Dependencies: []Dependency{
+		{Key: "A:solder"},
+		{Type: "time", MinValue: "8:00", MaxValue: "24:00"},
+		{Type: "date", MinValue: "2014-01-01", MaxValue: "2014-13-01"},
+	}}}
+	duplicate := MakeTestLevel("B", "default")
+	lonely := MakeTestLevel("C", "")
+
+	problems := validateLevels([]levelFile{
+		{"a.lvl", a},
+		{"b.lvl", b},
+		{"b2.lvl", duplicate},
+		{"c.lvl", lonely},
+	})
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+
+	expected := []string{
+		`a.lvl: A: direction West leads to unknown station "X"`,
+		`a.lvl: A: warning: action solder: no action changes attribute "strength"`,
+		`a.lvl: A: action solder: attribute value "ten" is not a number`,
+		`a.lvl: A: action solder: unknown dependency type "tmie"`,
+		`b.lvl: B: direction West: time "24:00" is not formatted as HH:MM`,
+		`b.lvl: B: direction West: date "2014-13-01" is not formatted as YYYY-MM-DD`,
+		`b2.lvl: B: key is used by b.lvl already`,
+		`c.lvl: C: warning: level can not be reached from the default level`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Validation found:\n%s\nshould find:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	problems = validateLevels([]levelFile{
+		{"a.lvl", MakeTestLevel("A", "default")},
+		{"b.lvl", MakeTestLevel("B", "default")},
+	})
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "more than one level is tagged as default") {
+		t.Errorf("Two default levels should be reported, got %v", problems)
+	}
+
+	problems = validateLevels([]levelFile{
+		{"a.lvl", MakeTestLevel("A", "")},
+	})
+	if len(problems) != 1 || problems[0].Message != "no level is tagged as default" {
+		t.Errorf("A missing default level should be reported, got %v", problems)
+	}
+
+	b.Directions[0].Dependencies = []Dependency{{Key: "A:dance"}}
+	problems = validateLevels([]levelFile{{"a.lvl", a}, {"b.lvl", b}})
+	found := false
+	for _, p := range problems {
+		found = found || p.String() == `b.lvl: B: warning: direction West: no level or action produces dependency key "A:dance"`
+	}
+	if !found {
+		t.Errorf("Dependency keys nobody can produce should be reported, got %v", problems)
+	}
+}
+
+func TestValidateItems(t *testing.T) {
+	a := MakeTestLevel("A", "default")
+	a.Items = []Item{{Key: "iron", Name: "soldering iron"}}
+	a.Actions = []Action{{Name: "solder", Dependencies: []Dependency{
+		{Key: "iron", Type: "item"},
+		{Key: "lamp", Type: "item"},
+	}}}
+	b := MakeTestLevel("B", "")
+	b.Items = []Item{{Key: "iron", Name: "another iron"}}
+	b.Directions = []Direction{MakeTestDirection("A", "West")}
+	a.Directions = []Direction{MakeTestDirection("B", "East")}
+
+	var got []string
+	for _, p := range validateLevels([]levelFile{{"a.lvl", a}, {"b.lvl", b}}) {
+		got = append(got, p.String())
+	}
+	expected := []string{
+		`a.lvl: A: warning: action solder: unknown item "lamp"`,
+		`b.lvl: B: item key "iron" is used by a.lvl already`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Validation found:\n%s\nshould find:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestValidateEffects(t *testing.T) {
+	a := MakeTestLevel("A", "default")
+	a.Actions = []Action{
+		{Name: "train", Effects: []Effect{
+			{Type: "attribute", Key: "strength", Value: "5"},
+			{Type: "action", Key: "trained"},
+			{Type: "teleport", Key: "X"},
+			{Type: "item", Key: "medal"},
+			{Type: "spell", Key: "fireball"},
+		}},
+		{Name: "lift", Dependencies: []Dependency{
+			{Key: "Strength", Type: "attribute", MinValue: "3"},
+			{Key: "trained"},
+		}},
+	}
+
+	var got []string
+	for _, p := range validateLevels([]levelFile{{"a.lvl", a}}) {
+		got = append(got, p.String())
+	}
+	expected := []string{
+		`a.lvl: A: action train: teleport to unknown station "X"`,
+		`a.lvl: A: action train: unknown item "medal"`,
+		`a.lvl: A: action train: unknown effect type "spell"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Validation found:\n%s\nshould find:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	a := MakeTestLevel("A", "default")
+	a.Actions = []Action{
+		{Name: "dance"},
+		{Name: "sing", Groups: Groups{
+			Any: []DependencyGroup{{
+				Dependencies: []Dependency{{Key: "A:dance"}, {Key: "A:fly"}},
+				Groups:       Groups{Not: []DependencyGroup{{}}},
+			}},
+			All: []DependencyGroup{{}},
+		}},
+	}
+
+	var got []string
+	for _, p := range validateLevels([]levelFile{{"a.lvl", a}}) {
+		got = append(got, p.String())
+	}
+	expected := []string{
+		`a.lvl: A: warning: action sing: no level or action produces dependency key "A:fly"`,
+		`a.lvl: A: warning: action sing: empty <all> group`,
+		`a.lvl: A: warning: action sing: empty <not> group`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Validation found:\n%s\nshould find:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// groups from level files are reported in the order of the file
+	var action Action
+	if err := xml.Unmarshal([]byte(`<action name="sing"><not/><any><dependency key="A"/></any><all/></action>`), &action); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, p := range emptyGroups(action.Conditions()) {
+		got = append(got, p.Message)
+	}
+	if strings.Join(got, ", ") != "empty <not> group, empty <all> group" {
+		t.Errorf("Empty groups should be reported in order, got %v", got)
+	}
+}
+
+func TestValidateExpressions(t *testing.T) {
+	a := MakeTestLevel("A", "default")
+	a.Items = []Item{{Key: "iron", Name: "soldering iron"}}
+	a.Actions = []Action{
+		{Name: "dance"},
+		{Name: "sing", Dependencies: []Dependency{
+			{Type: "expression", Expression: `has("A:dance") && item("iron") && hour() in 20..4`},
+			{Type: "expression", Expression: `has("A:fly") || attr("karma") > 1 || item("lamp")`},
+			{Type: "expression", Expression: `has("A:dance") &&`},
+			{Type: "expression"},
+			{Expression: `item("iron")`},
+		}},
+	}
+
+	var got []string
+	for _, p := range validateLevels([]levelFile{{"a.lvl", a}}) {
+		got = append(got, p.String())
+	}
+	expected := []string{
+		`a.lvl: A: warning: action sing: no level or action produces dependency key "A:fly"`,
+		`a.lvl: A: warning: action sing: no action changes attribute "karma"`,
+		`a.lvl: A: action sing: expected a value but found end of expression at column 18 of expression "has(\"A:dance\") &&"`,
+		`a.lvl: A: action sing: expression dependency has no <expression>`,
+		`a.lvl: A: warning: action sing: unknown item "lamp"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Validation found:\n%s\nshould find:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestValidateTimes(t *testing.T) {
+	a := MakeTestLevel("A", "default")
+	a.Actions = []Action{
+		{Name: "party", Dependencies: []Dependency{
+			{Type: "time", MinValue: "22:00", MaxValue: "4:00"},
+			{Type: "time", Days: "fri-sun"},
+			{Type: "time", MinValue: "22:00", MaxValue: "04:00", Days: "fri,caturday"},
+			{Type: "time", MinValue: "22:00"},
+			{Type: "time"},
+		}},
+	}
+
+	var got []string
+	for _, p := range validateLevels([]levelFile{{"a.lvl", a}}) {
+		got = append(got, p.String())
+	}
+	expected := []string{
+		`a.lvl: A: action party: unknown day of the week "caturday"`,
+		`a.lvl: A: action party: time "" is not formatted as HH:MM`,
+		`a.lvl: A: action party: time "" is not formatted as HH:MM`,
+		`a.lvl: A: action party: time "" is not formatted as HH:MM`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Validation found:\n%s\nshould find:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestValidateGameTime(t *testing.T) {
+	a := MakeTestLevel("A", "default")
+	a.Messages = []Message{
+		{Text: "night", Dependencies: []Dependency{{Type: "gametime", Key: "dusk,night"}}},
+		{Text: "morning", Dependencies: []Dependency{{Type: "gametime", MinValue: "6:00", MaxValue: "10:00", Days: "sun"}}},
+		{Text: "noon", Dependencies: []Dependency{{Type: "gametime", Key: "noon"}}},
+		{Text: "never", Dependencies: []Dependency{{Type: "gametime"}}},
+		{Text: "late", Dependencies: []Dependency{{Type: "gametime", MinValue: "25:00", MaxValue: "04:00"}}},
+	}
+
+	var got []string
+	for _, p := range validateLevels([]levelFile{{"a.lvl", a}}) {
+		got = append(got, p.String())
+	}
+	expected := []string{
+		`a.lvl: A: message 3: unknown phase "noon", phases are dawn, day, dusk and night`,
+		`a.lvl: A: message 4: gametime dependency needs a phase key or times`,
+		`a.lvl: A: message 5: time "25:00" is not formatted as HH:MM`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Validation found:\n%s\nshould find:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,137 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Levels returns all loaded levels sorted by key.
+func (s *Server) Levels() []Level {
+	s.lock.RLock()
+	levels := make([]Level, 0, len(s.levels))
+	for _, level := range s.levels {
+		levels = append(levels, level)
+	}
+	s.lock.RUnlock()
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Key < levels[j].Key
+	})
+	return levels
+}
+
+// MapRoom is a room of the world map export.
+type MapRoom struct {
+	Key     string    `json:"key"`
+	Name    string    `json:"name"`
+	Default bool      `json:"default,omitempty"`
+	Exits   []MapExit `json:"exits"`
+}
+
+// MapExit is a direction leading out of a room.
+type MapExit struct {
+	Direction string `json:"direction"`
+	Station   string `json:"station"`
+	Hidden    bool   `json:"hidden,omitempty"`
+	// Gated exits have dependencies the player has to meet
+	Gated bool `json:"gated,omitempty"`
+}
+
+// WorldMap describes the rooms and their exits.
+func WorldMap(levels []Level) []MapRoom {
+	rooms := make([]MapRoom, 0, len(levels))
+	for _, level := range levels {
+		room := MapRoom{
+			Key:     level.Key,
+			Name:    level.Name,
+			Default: level.Tag == "default",
+			Exits:   []MapExit{},
+		}
+		for _, d := range level.Directions {
+			room.Exits = append(room.Exits, MapExit{
+				Direction: d.Direction,
+				Station:   d.Station,
+				Hidden:    d.Hidden,
+				Gated:     !d.Conditions().IsEmpty(),
+			})
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// WriteMapJSON writes the world map as JSON adjacency list.
+func WriteMapJSON(w io.Writer, levels []Level) error {
+	data, err := json.MarshalIndent(struct {
+		Rooms []MapRoom `json:"rooms"`
+	}{WorldMap(levels)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteMapDOT writes the world map as Graphviz graph. Hidden exits are
+// dashed, exits with dependencies red.
+func WriteMapDOT(w io.Writer, name string, levels []Level) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(name))
+	b.WriteString("    node [shape=box];\n")
+	for _, room := range WorldMap(levels) {
+		attributes := "label=" + dotQuote(room.Name)
+		if room.Default {
+			attributes += ", peripheries=2"
+		}
+		fmt.Fprintf(&b, "    %s [%s];\n", dotQuote(room.Key), attributes)
+	}
+	for _, room := range WorldMap(levels) {
+		for _, exit := range room.Exits {
+			attributes := "label=" + dotQuote(exit.Direction)
+			if exit.Hidden {
+				attributes += ", style=dashed"
+			}
+			if exit.Gated {
+				attributes += ", color=red, fontcolor=red"
+			}
+			fmt.Fprintf(&b, "    %s -> %s [%s];\n", dotQuote(room.Key), dotQuote(exit.Station), attributes)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMapText writes the world map as plain text, one room with its exits
+// per block.
+func WriteMapText(w io.Writer, levels []Level) error {
+	var b strings.Builder
+	for _, room := range WorldMap(levels) {
+		fmt.Fprintf(&b, "%s (%s)", room.Name, room.Key)
+		if room.Default {
+			b.WriteString(" [default]")
+		}
+		b.WriteString("\n")
+		for _, exit := range room.Exits {
+			fmt.Fprintf(&b, "  %-10s -> %s", exit.Direction, exit.Station)
+			if exit.Hidden {
+				b.WriteString(" [hidden]")
+			}
+			if exit.Gated {
+				b.WriteString(" [gated]")
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
@@ -0,0 +1,69 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func makeTestMap() []Level {
+	a := MakeTestLevel("A", "default")
+	a.Directions = []Direction{MakeTestDirection("B", "East")}
+	b := MakeTestLevel("B", "")
+	hidden := MakeTestDirection("A", "West")
+	hidden.Hidden = true
+	hidden.Dependencies = []Dependency{{Key: "A"}}
+	b.Directions = []Direction{hidden}
+	b.Name = `The "B"`
+	return []Level{a, b}
+}
+
+func TestWriteMapDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMapDOT(&buf, "test", makeTestMap()); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph "test" {
+    node [shape=box];
+    "A" [label="RoomA", peripheries=2];
+    "B" [label="The \"B\""];
+    "A" -> "B" [label="East"];
+    "B" -> "A" [label="West", style=dashed, color=red, fontcolor=red];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("DOT export is\n%s\nshould be\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteMapJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMapJSON(&buf, makeTestMap()); err != nil {
+		t.Fatal(err)
+	}
+	var exported struct {
+		Rooms []MapRoom `json:"rooms"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported.Rooms) != 2 || !exported.Rooms[0].Default || exported.Rooms[0].Exits[0].Station != "B" {
+		t.Errorf("JSON export should contain the rooms, got %s", buf.String())
+	}
+	exit := exported.Rooms[1].Exits[0]
+	if !exit.Hidden || !exit.Gated || exit.Direction != "West" {
+		t.Errorf("JSON export should mark hidden and gated exits, got %+v", exit)
+	}
+}
+
+func TestWriteMapText(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMapText(&buf, makeTestMap())
+	if !strings.Contains(buf.String(), "RoomA (A) [default]\n  East       -> B\n") {
+		t.Errorf("Text export should list the exits, got %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "West       -> A [hidden] [gated]") {
+		t.Errorf("Text export should mark hidden and gated exits, got %q", buf.String())
+	}
+}
@@ -0,0 +1,152 @@
+package game
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// wrapToken is either a single visible rune or a zero width ANSI escape
+// sequence.
+type wrapToken struct {
+	text    string
+	visible bool
+}
+
+func tokenize(text string) []wrapToken {
+	var tokens []wrapToken
+	for i := 0; i < len(text); {
+		if text[i] == '\033' {
+			end := escapeEnd(text, i)
+			tokens = append(tokens, wrapToken{text: text[i:end]})
+			i = end
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		tokens = append(tokens, wrapToken{text: text[i : i+size], visible: true})
+		i += size
+	}
+	return tokens
+}
+
+// escapeEnd returns the index behind the escape sequence starting at i.
+// CSI sequences (ESC [ ... final byte) are consumed completely, all other
+// sequences are treated as ESC plus one byte.
+func escapeEnd(text string, i int) int {
+	if i+1 >= len(text) {
+		return len(text)
+	}
+	if text[i+1] != '[' {
+		return i + 2
+	}
+	for j := i + 2; j < len(text); j++ {
+		if text[j] >= 0x40 && text[j] <= 0x7e {
+			return j + 1
+		}
+	}
+	return len(text)
+}
+
+// VisibleLength counts the runes of text that take up a column on the
+// terminal, ANSI escape sequences are not counted.
+func VisibleLength(text string) int {
+	length := 0
+	for _, t := range tokenize(text) {
+		if t.visible {
+			length++
+		}
+	}
+	return length
+}
+
+// lineWrapper collects tokens into lines of at most width visible runes.
+// Colors that are still active at a line break are reset at the end of the
+// line and restored at the beginning of the next one.
+type lineWrapper struct {
+	width   int
+	lines   []string
+	line    []string
+	lineLen int
+	active  string
+}
+
+func (w *lineWrapper) add(t wrapToken) {
+	w.line = append(w.line, t.text)
+	if t.visible {
+		w.lineLen++
+		return
+	}
+	if strings.HasSuffix(t.text, "m") && strings.HasPrefix(t.text, "\033[") {
+		if t.text == "\033[m" || t.text == "\033[0m" {
+			w.active = ""
+		} else {
+			w.active += t.text
+		}
+	}
+}
+
+func (w *lineWrapper) breakLine() {
+	line := strings.Join(w.line, "")
+	if w.active != "" {
+		line += "\033[0m"
+	}
+	w.lines = append(w.lines, line)
+	w.line = nil
+	w.lineLen = 0
+	if w.active != "" {
+		w.line = append(w.line, w.active)
+	}
+}
+
+func (w *lineWrapper) addWord(spaces []wrapToken, word []wrapToken, wordLen int) {
+	if w.lineLen > 0 && w.lineLen+len(spaces)+wordLen > w.width {
+		w.breakLine()
+	} else {
+		for _, s := range spaces {
+			w.add(s)
+		}
+	}
+	for _, t := range word {
+		if t.visible && w.lineLen >= w.width {
+			w.breakLine()
+		}
+		w.add(t)
+	}
+}
+
+// WrapText breaks text into lines of at most width visible runes. Lines are
+// broken at spaces, words longer than a line are split. Existing line
+// breaks are kept. A width of zero or less disables wrapping.
+func WrapText(text string, width int) []string {
+	text = strings.Replace(text, "\r", "", -1)
+	paragraphs := strings.Split(text, "\n")
+	if width <= 0 {
+		return paragraphs
+	}
+
+	var lines []string
+	for _, paragraph := range paragraphs {
+		w := &lineWrapper{width: width}
+		var spaces, word []wrapToken
+		wordLen := 0
+		for _, t := range tokenize(paragraph) {
+			if t.text == " " {
+				if wordLen > 0 {
+					w.addWord(spaces, word, wordLen)
+					spaces, word, wordLen = nil, nil, 0
+				}
+				spaces = append(spaces, t)
+				continue
+			}
+			word = append(word, t)
+			if t.visible {
+				wordLen++
+			}
+		}
+		if len(word) > 0 {
+			w.addWord(spaces, word, wordLen)
+		}
+		lines = append(lines, w.lines...)
+		lines = append(lines, strings.Join(w.line, ""))
+	}
+	return lines
+}
@@ -0,0 +1,42 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+var wrapTests = []struct {
+	in    string
+	width int
+	out   []string
+}{
+	{"short text", 20, []string{"short text"}},
+	{"no wrapping", 0, []string{"no wrapping"}},
+	{"the quick brown fox", 10, []string{"the quick", "brown fox"}},
+	{"the  quick", 5, []string{"the", "quick"}},
+	{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+	{"first\n\rsecond line", 8, []string{"first", "second", "line"}},
+	{"  indented text", 20, []string{"  indented text"}},
+	{"äöü äöü äöü", 7, []string{"äöü äöü", "äöü"}},
+	{"you are \033[1mat home\033[0m now", 11, []string{"you are \033[1mat\033[0m", "\033[1mhome\033[0m now"}},
+	{"trailing   ", 20, []string{"trailing"}},
+	{"", 20, []string{""}},
+}
+
+func TestWrapText(t *testing.T) {
+	for _, tt := range wrapTests {
+		out := WrapText(tt.in, tt.width)
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("wrapping %q at %d got %q, should be %q", tt.in, tt.width, out, tt.out)
+		}
+	}
+}
+
+func TestVisibleLength(t *testing.T) {
+	if l := VisibleLength("\033[1;30;41mAlexanderplatz\033[0m"); l != 14 {
+		t.Errorf("Escape sequences should not be counted, got %d", l)
+	}
+	if l := VisibleLength("Brücke"); l != 6 {
+		t.Errorf("Runes should be counted, got %d", l)
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"os/exec"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/woodworker/go-mud/game"
 )
@@ -15,6 +21,34 @@ import (
 func main() {
 	workingdir, _ := os.Getwd()
 
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		if len(os.Args) > 2 {
+			workingdir = os.Args[2]
+		}
+		os.Exit(validate(workingdir))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "map" {
+		format := "dot"
+		if len(os.Args) > 2 {
+			format = os.Args[2]
+		}
+		if len(os.Args) > 3 {
+			workingdir = os.Args[3]
+		}
+		os.Exit(exportMap(workingdir, format))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "password" {
+		if len(os.Args) < 3 {
+			fmt.Println("usage: go-mud password <nick> [workingdir]")
+			os.Exit(2)
+		}
+		if len(os.Args) > 3 {
+			workingdir = os.Args[3]
+		}
+		os.Exit(setPassword(workingdir, os.Args[2]))
+	}
+
 	log.Printf("Leveldir %s", workingdir+"/static/levels/")
 
 	server := game.NewServer(workingdir)
@@ -30,7 +64,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	ln, err := net.Listen("tcp", server.Config.Interface)
+	ln, err := net.Listen("tcp", server.GetConfig().Interface)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -38,41 +72,230 @@ func main() {
 
 	log.Printf("Listen on: %s", ln.Addr())
 
-	msgchan := make(chan string)
-	addchan := make(chan game.Client)
-	rmchan := make(chan game.Client)
+	go func() {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		for range reload {
+			err := server.Reload()
+			if verr, ok := err.(*game.ValidationError); ok {
+				for _, problem := range verr.Problems {
+					log.Println(problem)
+				}
+			}
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Println("Received signal, shutting down (again to skip the countdown)")
+
+		// a second signal skips the countdown and waiting for connections
+		timeout := time.Duration(server.GetConfig().ShutdownCountdown)*time.Second + shutdownTimeout
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		go func() {
+			select {
+			case <-signals:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	err = server.Serve(ln, func(conn net.Conn) {
+		handleConnection(conn, server)
+	})
+	if err != game.ErrServerClosed {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	<-stopped
+}
+
+// validate checks the levels of workingdir and prints the problems, it
+// returns the exit code.
+func validate(workingdir string) int {
+	log.SetOutput(ioutil.Discard)
+	problems, err := game.ValidateLevels(workingdir + "/static/levels/")
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	errors := len(game.Errors(problems))
+	if len(problems) > 0 {
+		fmt.Printf("%d error(s) and %d warning(s) found\n", errors, len(problems)-errors)
+	}
+	if errors > 0 {
+		return 1
+	}
+	fmt.Println("levels are valid")
+	return 0
+}
+
+// exportMap prints the world map of workingdir as dot, json or text, it
+// returns the exit code.
+func exportMap(workingdir string, format string) int {
+	log.SetOutput(ioutil.Discard)
+	server := game.NewServer(workingdir)
+	if err := server.LoadLevels(); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	var err error
+	switch format {
+	case "dot":
+		err = game.WriteMapDOT(os.Stdout, server.GetName(), server.Levels())
+	case "json":
+		err = game.WriteMapJSON(os.Stdout, server.Levels())
+	case "text":
+		err = game.WriteMapText(os.Stdout, server.Levels())
+	default:
+		fmt.Printf("unknown map format %s, use dot, json or text\n", format)
+		return 2
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// setPassword reads a new password for the player nick from stdin and saves
+// it, it returns the exit code.
+func setPassword(workingdir string, nick string) int {
+	log.SetOutput(ioutil.Discard)
+	server := game.NewServer(workingdir)
+	if !server.LoadPlayer(nick) {
+		fmt.Printf("player %s does not exist\n", nick)
+		return 2
+	}
+
+	fmt.Printf("New password for %s: ", nick)
+	if stdinIsTerminal() {
+		setTerminalEcho(false)
+		defer setTerminalEcho(true)
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Println()
+	if err != nil && err != io.EOF {
+		fmt.Println(err)
+		return 2
+	}
+	if !server.SetPlayerPassword(nick, strings.TrimSpace(password)) {
+		fmt.Println("could not set the password")
+		return 1
+	}
+	fmt.Println("password set")
+	return 0
+}
+
+// stdinIsTerminal reports whether stdin is a terminal and not a pipe or a
+// file.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// setTerminalEcho turns the echo of the terminal on stdin on or off.
+func setTerminalEcho(on bool) {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	stty := exec.Command("stty", mode)
+	stty.Stdin = os.Stdin
+	if err := stty.Run(); err != nil {
+		log.Println(err)
+	}
+}
 
-	go handleMessages(msgchan, addchan, rmchan)
+// shutdownTimeout is how long a shutdown waits for connections to close
+// after the countdown.
+const shutdownTimeout = 10 * time.Second
 
+func promptMessage(c net.Conn, bufc *bufio.Reader, message string) (string, error) {
 	for {
-		conn, err := ln.Accept()
+		io.WriteString(c, message)
+		answer, _, err := bufc.ReadLine()
 		if err != nil {
-			fmt.Println(err)
-			continue
+			return "", err
+		}
+		if string(answer) != "" {
+			return string(answer), nil
 		}
-
-		go handleConnection(conn, msgchan, addchan, rmchan, server)
 	}
 }
 
-func promptMessage(c net.Conn, bufc *bufio.Reader, message string) string {
+func promptPassword(c *game.TelnetConn, bufc *bufio.Reader, message string) (string, error) {
 	for {
 		io.WriteString(c, message)
-		answer, _, _ := bufc.ReadLine()
+		c.SuppressEcho(true)
+		answer, _, err := bufc.ReadLine()
+		c.SuppressEcho(false)
+		io.WriteString(c, "\n\r")
+		if err != nil {
+			return "", err
+		}
 		if string(answer) != "" {
-			return string(answer)
+			return string(answer), nil
 		}
 	}
 }
 
-func handleConnection(c net.Conn, msgchan chan<- string, addchan chan<- game.Client, rmchan chan<- game.Client, server *game.Server) {
+func promptNewPassword(c *game.TelnetConn, bufc *bufio.Reader) (string, error) {
+	for {
+		password, err := promptPassword(c, bufc, "Please choose a password: ")
+		if err != nil {
+			return "", err
+		}
+		repeated, err := promptPassword(c, bufc, "Please repeat the password: ")
+		if err != nil {
+			return "", err
+		}
+		if password == repeated {
+			return password, nil
+		}
+		io.WriteString(c, "Passwords do not match.\n\r")
+	}
+}
+
+// loginFailed tells the user why the login ended when a prompt failed.
+func loginFailed(c net.Conn, err error) {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		log.Printf("Login of %v timed out", c.RemoteAddr())
+		io.WriteString(c, "\n\rLogin timed out, see you\n\r")
+	}
+}
+
+func handleConnection(conn net.Conn, server *game.Server) {
+	c := game.NewTelnetConn(conn)
+	c.AcceptLocal(game.TelnetOptSuppressGoAhead)
+	c.RequestWindowSize()
 	bufc := bufio.NewReader(c)
 	defer c.Close()
 
 	log.Println("New connection open:", c.RemoteAddr())
 
 	io.WriteString(c, fmt.Sprintf("\033[1;30;41mWelcome to \"%s\" Go-MUD Server!\033[0m\n\r", server.GetName()))
-	io.WriteString(c, server.Config.Motd)
+	io.WriteString(c, server.GetConfig().Motd)
+
+	if loginTimeout := server.GetConfig().LoginTimeout; loginTimeout > 0 {
+		c.SetReadDeadline(time.Now().Add(time.Duration(loginTimeout) * time.Second))
+	}
 
 	initialConnection := false
 
@@ -84,7 +307,12 @@ func handleConnection(c net.Conn, msgchan chan<- string, addchan chan<- game.Cli
 			return
 		}
 
-		nickname = promptMessage(c, bufc, "Whats your Nick?\n\r  ")
+		var err error
+		nickname, err = promptMessage(c, bufc, "Whats your Nick?\n\r  ")
+		if err != nil {
+			loginFailed(c, err)
+			return
+		}
 		isValidName := server.IsValidUsername(nickname);
 		if !isValidName {
 			questions++
@@ -92,28 +320,84 @@ func handleConnection(c net.Conn, msgchan chan<- string, addchan chan<- game.Cli
 			continue
 		}
 
+		if server.IsLockedOut(nickname) {
+			io.WriteString(c, "Too many failed logins, please try again later.\n\r")
+			return
+		}
+
 		ok := server.LoadPlayer(nickname)
 
 		if ok == false {
 			questions++
 			io.WriteString(c, fmt.Sprintf("Username %s does not exists.\n\r", nickname))
-			answer := promptMessage(c, bufc, "Do you want to create that user? [y|n] ")
+			answer, err := promptMessage(c, bufc, "Do you want to create that user? [y|n] ")
+			if err != nil {
+				loginFailed(c, err)
+				return
+			}
 
 			if answer == "y" {
-				gameName := promptMessage(c, bufc, "Please enter your ingame Name: ")
-				playerType := promptMessage(c, bufc, "Please enter your character type: ")
-
-				server.CreatePlayer(nickname, gameName, playerType)
+				gameName, err := promptMessage(c, bufc, "Please enter your ingame Name: ")
+				if err != nil {
+					loginFailed(c, err)
+					return
+				}
+				playerType, err := promptMessage(c, bufc, "Please enter your character type: ")
+				if err != nil {
+					loginFailed(c, err)
+					return
+				}
+				password, err := promptNewPassword(c, bufc)
+				if err != nil {
+					loginFailed(c, err)
+					return
+				}
+
+				if !server.CreatePlayer(nickname, gameName, playerType, password) {
+					io.WriteString(c, "Could not create user.\n\r")
+					return
+				}
 				initialConnection = true
 				break
 			}
 		}
 
 		if ok == true {
-			break
+			player, _ := server.GetPlayerByNick(nickname)
+			if !player.HasPassword() {
+				// whoever logs in first must not choose the password
+				log.Printf("Login of %s refused, the account has no password", nickname)
+				io.WriteString(c, "Your account has no password yet, please ask an admin to set one.\n\r")
+				return
+			}
+
+			password, err := promptPassword(c, bufc, "Password: ")
+			if err != nil {
+				loginFailed(c, err)
+				return
+			}
+			if server.Authenticate(nickname, password) {
+				break
+			}
+			questions++
+			io.WriteString(c, "Wrong password.\n\r")
 		}
 	}
 
+	if presence, online := server.IsOnline(nickname); online && !presence.LinkDead {
+		answer, err := promptMessage(c, bufc, "You are already logged in from another connection. Take over that session? [y|n] ")
+		if err != nil {
+			loginFailed(c, err)
+			return
+		}
+		if answer != "y" {
+			io.WriteString(c, "See you\n\r")
+			return
+		}
+	}
+
+	c.SetReadDeadline(time.Time{})
+
 	player, playerLoaded := server.GetPlayerByNick(nickname)
 
 	if !playerLoaded {
@@ -123,6 +407,7 @@ func handleConnection(c net.Conn, msgchan chan<- string, addchan chan<- game.Cli
 	}
 
 	client := game.NewClient(c, player)
+	client.Width = server.GetConfig().Width
 
 	if strings.TrimSpace(client.Nickname) == "" {
 		log.Println("invalid username")
@@ -131,15 +416,18 @@ func handleConnection(c net.Conn, msgchan chan<- string, addchan chan<- game.Cli
 	}
 
 	// Register user
-	addchan <- client
+	resumed := server.StartSession(client)
 	defer func() {
-		msgchan <- fmt.Sprintf("User %s left the chat room.\n\r", client.Nickname)
+		server.EndSession(client)
 		log.Printf("Connection from %v closed.\n", c.RemoteAddr())
-		rmchan <- client
 	}()
-	io.WriteString(c, fmt.Sprintf("Welcome, %s!\n\n\r", client.Player.Gamename))
+	if resumed {
+		io.WriteString(c, fmt.Sprintf("Welcome back, %s!\n\n\r", client.Player.Gamename))
+	} else {
+		io.WriteString(c, fmt.Sprintf("Welcome, %s!\n\n\r", client.Player.Gamename))
+	}
 
-	location, locationLoaded := server.GetRoom(client.Player.Position)
+	location, locationLoaded := server.GetRoom(client.Player.GetPosition())
 
 	if locationLoaded {
 		if initialConnection {
@@ -149,26 +437,7 @@ func handleConnection(c net.Conn, msgchan chan<- string, addchan chan<- game.Cli
 	}
 
 	// I/O
-	go client.ReadLinesInto(msgchan, server)
+	go client.ReadLinesInto(server)
 	client.WriteLinesFrom(client.Ch)
-}
-
-func handleMessages(msgchan <-chan string, addchan <-chan game.Client, rmchan <-chan game.Client) {
-	clients := make(map[net.Conn]chan<- string)
-
-	for {
-		select {
-		case msg := <-msgchan:
-			log.Printf("New message: %s", msg)
-			for _, ch := range clients {
-				go func(mch chan<- string) { mch <- "\033[1;33;40m" + msg + "\033[m\n\r" }(ch)
-			}
-		case client := <-addchan:
-			log.Printf("New client: %v\n\r\n\r", client.Conn)
-			clients[client.Conn] = client.Ch
-		case client := <-rmchan:
-			log.Printf("Client disconnects: %v\n\r\n\r", client.Conn)
-			delete(clients, client.Conn)
-		}
-	}
+	client.Close()
 }